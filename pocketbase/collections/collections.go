@@ -7,4 +7,14 @@ const (
 	ResendAPIKeys        = "resend_api_keys"
 	ResendWebhookSecrets = "resend_webhook_secrets"
 	EventLogs            = "event_logs"
+	ForwardingJobs       = "forwarding_jobs"
+	WebhookReceipts      = "webhook_receipts"
+	RuleDestinations     = "rule_destinations"
+	ForwardingDeliveries = "forwarding_deliveries"
+	DeliveryProviders    = "delivery_providers"
+	Suppressions         = "suppressions"
+	SenderFilters        = "sender_filters"
+	Quarantine           = "quarantine"
+	ReverseAliases       = "reverse_aliases"
+	SecurityAuditLogs    = "security_audit_logs"
 )
@@ -8,8 +8,11 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/api"
 	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/crons"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/providers"
 	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
 	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/smtpd"
 
 	_ "github.com/lsherman98/resendforward/pocketbase/migrations"
 	"github.com/pocketbase/pocketbase"
@@ -41,6 +44,18 @@ func main() {
 		log.Fatal("Failed to initialize rules hooks: ", err)
 	}
 
+	if err := jobs.Init(app); err != nil {
+		log.Fatal("Failed to initialize job workers: ", err)
+	}
+
+	if err := providers.Init(app); err != nil {
+		log.Fatal("Failed to initialize delivery provider hooks: ", err)
+	}
+
+	if err := smtpd.Init(app); err != nil {
+		log.Fatal("Failed to initialize SMTP listener: ", err)
+	}
+
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), true))
 		return se.Next()
@@ -51,6 +66,8 @@ func main() {
 		Automigrate: isGoRun,
 	})
 
+	app.RootCmd.AddCommand(secrets.NewReencryptCommand(app))
+
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
 	}
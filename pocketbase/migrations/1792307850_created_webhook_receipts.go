@@ -0,0 +1,142 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1044281977",
+					"max": 0,
+					"min": 0,
+					"name": "svix_id",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2363381545",
+					"max": 0,
+					"min": 0,
+					"name": "type",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2821898697",
+					"max": 0,
+					"min": 0,
+					"name": "email_id",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "number1326685452",
+					"max": null,
+					"min": null,
+					"name": "status_code",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "json1048251387",
+					"maxSize": 0,
+					"name": "response",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_4252949263",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_R7cXk2WnQa` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (` + "`" + `svix_id` + "`" + `)",
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Hm3vLs9TdE` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (\n  ` + "`" + `type` + "`" + `,\n  ` + "`" + `email_id` + "`" + `\n) WHERE ` + "`" + `email_id` + "`" + ` != ''"
+			],
+			"listRule": null,
+			"name": "webhook_receipts",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_4252949263")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,184 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3114130236",
+					"hidden": false,
+					"id": "relation1001261735",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "event",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3367978789",
+					"hidden": false,
+					"id": "relation1188605132",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "rule",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_910013372",
+					"hidden": false,
+					"id": "relation1053179562",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "destination",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1745156937",
+					"max": 0,
+					"min": 0,
+					"name": "recipient",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "select2063623452",
+					"maxSelect": 1,
+					"name": "status",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"pending",
+						"sent",
+						"delivered",
+						"failed"
+					]
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text624968971",
+					"max": 0,
+					"min": 0,
+					"name": "sent_email_id",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "json1574812785",
+					"maxSize": 0,
+					"name": "error",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_965634417",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Tg5sWc1NeY` + "`" + ` ON ` + "`" + `forwarding_deliveries` + "`" + ` (\n  ` + "`" + `event` + "`" + `,\n  ` + "`" + `recipient` + "`" + `\n)",
+				"CREATE INDEX ` + "`" + `idx_Kd2hFq7RuJ` + "`" + ` ON ` + "`" + `forwarding_deliveries` + "`" + ` (` + "`" + `sent_email_id` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "forwarding_deliveries",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_965634417")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": "@request.auth.id = user.id",
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"exceptDomains": null,
+					"hidden": false,
+					"id": "email3885137012",
+					"name": "email",
+					"onlyDomains": null,
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "email"
+				},
+				{
+					"hidden": false,
+					"id": "select1001949196",
+					"maxSelect": 1,
+					"name": "reason",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"hard_bounce",
+						"complaint"
+					]
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_3367978789",
+					"hidden": false,
+					"id": "relation1188605132",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "rule",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_3114130236",
+					"hidden": false,
+					"id": "relation3926588326",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "forwarding_event",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "json1108979077",
+					"maxSize": 0,
+					"name": "paused_rules",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "json2432952554",
+					"maxSize": 0,
+					"name": "disabled_destinations",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_3320720245",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Sp7kQw2ZrN` + "`" + ` ON ` + "`" + `suppressions` + "`" + ` (\n  ` + "`" + `user` + "`" + `,\n  ` + "`" + `email` + "`" + `\n)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "suppressions",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3320720245")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// gives users created before webhook tokens existed their webhook endpoint
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindAllRecords("_pb_users_auth_", dbx.HashExp{"webhook_token": ""})
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			user.Set("webhook_token", security.RandomString(32))
+			if err := app.SaveNoValidate(user); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		return nil
+	})
+}
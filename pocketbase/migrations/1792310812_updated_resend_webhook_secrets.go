@@ -0,0 +1,147 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2827686977")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"createRule": "@request.auth.id != \"\" && @request.body.user = @request.auth.id",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_webhook_token_pbc_2827686977` + "`" + ` ON ` + "`" + `resend_webhook_secrets` + "`" + ` (` + "`" + `webhook_token` + "`" + `) WHERE ` + "`" + `webhook_token` + "`" + ` != ''"
+			],
+			"updateRule": "@request.auth.id = user.id && (@request.body.user:isset = false || @request.body.user = @request.auth.id)"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1579384326",
+			"max": 0,
+			"min": 0,
+			"name": "name",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"autogeneratePattern": "[a-zA-Z0-9]{32}",
+			"hidden": false,
+			"id": "text3588703298",
+			"max": 0,
+			"min": 0,
+			"name": "webhook_token",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_803870139",
+			"hidden": false,
+			"id": "relation3373460893",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "api_key",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1554180325",
+			"max": 0,
+			"min": 0,
+			"name": "secret",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2827686977")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"createRule": "@request.auth.id != \"\"",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_5NS0M0If61` + "`" + ` ON ` + "`" + `resend_webhook_secrets` + "`" + ` (` + "`" + `user` + "`" + `)",
+				"CREATE UNIQUE INDEX ` + "`" + `idx_It7uRWvpur` + "`" + ` ON ` + "`" + `resend_webhook_secrets` + "`" + ` (\n  ` + "`" + `user` + "`" + `,\n  ` + "`" + `secret` + "`" + `\n)"
+			],
+			"updateRule": "@request.auth.id = user.id"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text1579384326")
+
+		// remove field
+		collection.Fields.RemoveById("text3588703298")
+
+		// remove field
+		collection.Fields.RemoveById("relation3373460893")
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1554180325",
+			"max": 0,
+			"min": 0,
+			"name": "secret",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": true,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
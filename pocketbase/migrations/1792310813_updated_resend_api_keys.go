@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_803870139")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"createRule": "@request.auth.id != \"\" && @request.body.user = @request.auth.id",
+			"indexes": [],
+			"updateRule": "@request.auth.id = user.id && (@request.body.user:isset = false || @request.body.user = @request.auth.id)"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1579384326",
+			"max": 0,
+			"min": 0,
+			"name": "name",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_803870139")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"createRule": "@request.auth.id != \"\"",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_eZWnbThzV4` + "`" + ` ON ` + "`" + `resend_api_keys` + "`" + ` (` + "`" + `user` + "`" + `)",
+				"CREATE UNIQUE INDEX ` + "`" + `idx_HOGZmiht3G` + "`" + ` ON ` + "`" + `resend_api_keys` + "`" + ` (\n  ` + "`" + `user` + "`" + `,\n  ` + "`" + `key` + "`" + `\n)"
+			],
+			"updateRule": "@request.auth.id = user.id"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text1579384326")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// moves the webhook token of every user to their webhook secret record, so
+// webhook URLs configured in Resend keep working, and links the record to the
+// user's API key. Users without a webhook secret get an empty record holding
+// their token.
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindAllRecords("_pb_users_auth_", dbx.NewExp("[[webhook_token]] != ''"))
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			accounts, err := app.FindAllRecords("pbc_2827686977", dbx.HashExp{"user": user.Id})
+			if err != nil {
+				return err
+			}
+
+			var account *core.Record
+			if len(accounts) > 0 {
+				account = accounts[0]
+			} else {
+				collection, err := app.FindCollectionByNameOrId("pbc_2827686977")
+				if err != nil {
+					return err
+				}
+				account = core.NewRecord(collection)
+				account.Set("user", user.Id)
+			}
+
+			account.Set("webhook_token", user.GetString("webhook_token"))
+			if apiKeys, err := app.FindAllRecords("pbc_803870139", dbx.HashExp{"user": user.Id}); err == nil && len(apiKeys) > 0 {
+				account.Set("api_key", apiKeys[0].Id)
+			}
+			if err := app.SaveNoValidate(account); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		return nil
+	})
+}
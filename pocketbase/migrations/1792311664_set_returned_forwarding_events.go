@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// gives events whose sender was sent a bounce notice by a disabled rule the
+// "returned" status, "bounced" now only means the forward itself bounced
+func init() {
+	m.Register(func(app core.App) error {
+		_, err := app.DB().NewQuery(
+			"UPDATE {{forwarding_events}} SET [[status]] = 'returned' WHERE [[status]] = 'bounced' AND [[id]] IN " +
+				"(SELECT [[event]] FROM {{event_logs}} WHERE [[type]] = 'bounce.sent')",
+		).Execute()
+		return err
+	}, func(app core.App) error {
+		_, err := app.DB().Update("forwarding_events", dbx.Params{"status": "bounced"}, dbx.HashExp{"status": "returned"}).Execute()
+		return err
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_4252949263")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_R7cXk2WnQa` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (\n  ` + "`" + `scope` + "`" + `,\n  ` + "`" + `svix_id` + "`" + `\n)",
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Hm3vLs9TdE` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (\n  ` + "`" + `scope` + "`" + `,\n  ` + "`" + `type` + "`" + `,\n  ` + "`" + `email_id` + "`" + `\n) WHERE ` + "`" + `email_id` + "`" + ` != ''"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text11490771",
+			"max": 0,
+			"min": 0,
+			"name": "scope",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_4252949263")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_R7cXk2WnQa` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (` + "`" + `svix_id` + "`" + `)",
+				"CREATE UNIQUE INDEX ` + "`" + `idx_Hm3vLs9TdE` + "`" + ` ON ` + "`" + `webhook_receipts` + "`" + ` (\n  ` + "`" + `type` + "`" + `,\n  ` + "`" + `email_id` + "`" + `\n) WHERE ` + "`" + `email_id` + "`" + ` != ''"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text11490771")
+
+		return app.Save(collection)
+	})
+}
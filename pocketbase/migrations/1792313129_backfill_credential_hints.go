@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// gives Resend API keys and webhook secrets saved before hints existed their
+// hint, clients treat credentials without one as not configured. Values that
+// can't be decrypted are left alone, they have to be set again anyway.
+func init() {
+	m.Register(func(app core.App) error {
+		credentials := map[string]string{
+			"resend_api_keys":        "key",
+			"resend_webhook_secrets": "secret",
+		}
+
+		for collection, field := range credentials {
+			records, err := app.FindAllRecords(collection,
+				dbx.HashExp{"hint": ""},
+				dbx.Not(dbx.HashExp{field: ""}),
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				value, err := secrets.Decrypt(record.GetString(field))
+				if err != nil {
+					app.Logger().Warn("Failed to decrypt credential for its hint: ", "collection", collection, "id", record.Id, "err", err)
+					continue
+				}
+
+				record.Set("hint", secrets.Hint(value))
+				if err := app.SaveNoValidate(record); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		return nil
+	})
+}
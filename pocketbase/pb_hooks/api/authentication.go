@@ -0,0 +1,207 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	AuthPolicyForward    = "forward"
+	AuthPolicyTag        = "tag"
+	AuthPolicyQuarantine = "quarantine"
+
+	authResultNone = "none"
+	authResultPass = "pass"
+	authResultFail = "fail"
+
+	authFailedSubjectTag = "[DMARC FAIL] "
+)
+
+// authResults are the SPF, DKIM and DMARC verdicts of a received email, as
+// reported by the receiving server.
+type authResults struct {
+	SPF   string `json:"spf"`
+	DKIM  string `json:"dkim"`
+	DMARC string `json:"dmarc"`
+
+	// dkimDomains are the header.d domains of the passing DKIM signatures
+	dkimDomains []string
+}
+
+// authenticates reports whether the results prove that the email comes from
+// the domain of the address: DMARC passed, or a DKIM signature of that domain
+// did.
+func (r authResults) authenticates(address string) bool {
+	if r.DMARC == authResultPass {
+		return true
+	}
+
+	_, domain := splitAddress(strings.ToLower(address))
+	return domain != "" && slices.Contains(r.dkimDomains, domain)
+}
+
+// trustedAuthservIDs returns the authserv-ids of the receivers whose
+// Authentication-Results headers are trusted, from the comma separated
+// TRUSTED_AUTHSERV_IDS.
+func trustedAuthservIDs() []string {
+	ids := []string{}
+	for _, id := range strings.Split(os.Getenv("TRUSTED_AUTHSERV_IDS"), ",") {
+		if id = strings.ToLower(strings.TrimSpace(id)); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// authenticationStatusHandler tells clients whether the instance trusts any
+// receiver's verdicts. Without TRUSTED_AUTHSERV_IDS every email is recorded as
+// "none" and the auth_policy of rules never applies.
+func authenticationStatusHandler(e *core.RequestEvent) error {
+	return e.JSON(http.StatusOK, map[string]any{
+		"configured": len(trustedAuthservIDs()) > 0,
+	})
+}
+
+// parseAuthResults reads the verdicts from the topmost Authentication-Results
+// header added by a trusted receiver (RFC 8601 section 5). Any sender can add
+// these headers, so instances with another authserv-id, ARC results and
+// Received-SPF are ignored. Methods that are missing are reported as "none".
+//
+// Resend returns headers as a map, so repeated headers reach us joined into
+// one value. A trusted header repeating its authserv-id or the SPF or DMARC
+// result may have a sender's header joined onto it and is ignored as a whole.
+func parseAuthResults(content *messageContent, trustedIDs []string) authResults {
+	results := authResults{SPF: authResultNone, DKIM: authResultNone, DMARC: authResultNone}
+
+	for _, header := range headerInstances(content, "Authentication-Results") {
+		parts := strings.Split(header, ";")
+
+		// the first element is the authserv-id, optionally followed by a
+		// version, every other one a method result such as
+		// "dkim=pass header.d=example.com"
+		authservID := strings.Fields(parts[0])
+		if len(authservID) == 0 || !slices.Contains(trustedIDs, strings.ToLower(authservID[0])) {
+			continue
+		}
+
+		if strings.Count(strings.ToLower(header), strings.ToLower(authservID[0])+";") > 1 {
+			return results
+		}
+
+		parsed := authResults{SPF: authResultNone, DKIM: authResultNone, DMARC: authResultNone}
+		seen := map[string]bool{}
+		for _, part := range parts[1:] {
+			method, result, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(result)
+			if len(fields) == 0 {
+				continue
+			}
+			result = strings.ToLower(strings.TrimRight(fields[0], ",;()"))
+
+			method = strings.ToLower(strings.TrimSpace(method))
+			switch method {
+			case "spf", "dmarc":
+				if seen[method] {
+					return results
+				}
+				if method == "spf" {
+					parsed.SPF = result
+				} else {
+					parsed.DMARC = result
+				}
+			case "dkim":
+				// one passing signature is enough
+				if parsed.DKIM != authResultPass {
+					parsed.DKIM = result
+				}
+				if result == authResultPass {
+					for _, property := range fields[1:] {
+						if domain, ok := strings.CutPrefix(strings.ToLower(property), "header.d="); ok {
+							parsed.dkimDomains = append(parsed.dkimDomains, strings.TrimRight(domain, ",;()"))
+						}
+					}
+				}
+			}
+			seen[method] = true
+		}
+
+		results = parsed
+		break
+	}
+
+	return results
+}
+
+// headerValue returns the first instance of a header, "" when it is missing.
+func headerValue(content *messageContent, name string) string {
+	if values := headerInstances(content, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// headerInstances returns every instance of a header in message order.
+func headerInstances(content *messageContent, name string) []string {
+	for key, values := range content.HeaderValues {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	for key, value := range content.Headers {
+		if strings.EqualFold(key, name) {
+			return []string{value}
+		}
+	}
+	return nil
+}
+
+// checkAuthentication stores the authentication verdicts on the event and
+// applies the rule's auth_policy to messages failing DMARC: forward leaves
+// them alone, tag marks their subject and quarantine stops the forward. It
+// returns the policy that was applied, "" when DMARC didn't fail. The SMTP
+// listener doesn't check SPF, DKIM or DMARC itself, so mail it received is
+// recorded as "none".
+func checkAuthentication(app core.App, event, rule *core.Record, content *messageContent) string {
+	results := saveAuthResults(app, event, content)
+
+	if results.DMARC != authResultFail {
+		return ""
+	}
+
+	policy := rule.GetString("auth_policy")
+	if policy == "" {
+		policy = AuthPolicyForward
+	}
+
+	logEvent(app, event.GetString("user"), rule.Id, event.Id, EventAuthFailed, map[string]any{
+		"spf":    results.SPF,
+		"dkim":   results.DKIM,
+		"dmarc":  results.DMARC,
+		"policy": policy,
+	})
+
+	return policy
+}
+
+// saveAuthResults reads the authentication verdicts of the event's email and
+// stores them on the event.
+func saveAuthResults(app core.App, event *core.Record, content *messageContent) authResults {
+	results := authResults{SPF: authResultNone, DKIM: authResultNone, DMARC: authResultNone}
+	if event.GetString("source") != SourceSMTP {
+		results = parseAuthResults(content, trustedAuthservIDs())
+	}
+
+	event.Set("authentication", results)
+	if err := app.Save(event); err != nil {
+		app.Logger().Error("Failed to save authentication results: ", "event_id", event.Id, "err", err)
+	}
+
+	return results
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	DestinationTypeSlack   = "slack"
+	DestinationTypeDiscord = "discord"
+
+	chatTextLimit = 1000
+)
+
+// deliverChatMessage posts a short summary of the email to a Slack or Discord
+// incoming webhook: subject, sender, the start of the text body and the names
+// of the attachments. The attachments themselves aren't sent.
+func deliverChatMessage(app core.App, event, rule, delivery *core.Record, content *messageContent, attempt int) error {
+	subject := content.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+
+	text := truncateText(strings.TrimSpace(content.Text), chatTextLimit)
+
+	filenames := make([]string, 0, len(content.Attachments))
+	for _, attachment := range content.Attachments {
+		filenames = append(filenames, attachment.Filename)
+	}
+
+	var payload any
+	if delivery.GetString("type") == DestinationTypeDiscord {
+		payload = discordMessage(subject, content.From, text, filenames)
+	} else {
+		payload = slackMessage(subject, content.From, text, filenames)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return postToDestination(app, event, rule, delivery, body, nil, attempt)
+}
+
+// slackMessage renders the email in Slack's Block Kit format, with a plain
+// text fallback for notifications.
+func slackMessage(subject, from, text string, filenames []string) map[string]any {
+	blocks := []map[string]any{
+		{
+			"type": "header",
+			"text": map[string]any{"type": "plain_text", "text": truncateText(subject, 150)},
+		},
+		{
+			"type": "context",
+			"elements": []map[string]any{
+				{"type": "mrkdwn", "text": "*From:* " + escapeSlack(from)},
+			},
+		},
+	}
+
+	if text != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "plain_text", "text": text},
+		})
+	}
+
+	if len(filenames) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type": "context",
+			"elements": []map[string]any{
+				{"type": "mrkdwn", "text": "*Attachments:* " + escapeSlack(strings.Join(filenames, ", "))},
+			},
+		})
+	}
+
+	return map[string]any{
+		"text":   escapeSlack(subject + " from " + from),
+		"blocks": blocks,
+	}
+}
+
+// discordMessage renders the email as a single Discord embed.
+func discordMessage(subject, from, text string, filenames []string) map[string]any {
+	embed := map[string]any{
+		"title":       truncateText(subject, 256),
+		"author":      map[string]any{"name": truncateText(from, 256)},
+		"description": text,
+	}
+
+	if len(filenames) > 0 {
+		embed["fields"] = []map[string]any{{
+			"name":  "Attachments",
+			"value": truncateText(strings.Join(filenames, "\n"), 1024),
+		}}
+	}
+
+	return map[string]any{
+		"embeds":           []map[string]any{embed},
+		"allowed_mentions": map[string]any{"parse": []string{}},
+	}
+}
+
+// truncateText shortens s to at most limit runes, ending with an ellipsis
+// when anything was cut off.
+func truncateText(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
+
+func escapeSlack(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
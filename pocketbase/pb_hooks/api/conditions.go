@@ -0,0 +1,58 @@
+package api
+
+import (
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// evaluateConditions runs the rule's conditions against the received email
+// and records the decision in the event logs. Rules without conditions, or
+// with conditions that can no longer be parsed, forward everything.
+func evaluateConditions(app core.App, event, rule *core.Record, content *messageContent) rules.Condition {
+	conditions, err := rules.Conditions(rule)
+	if err != nil {
+		app.Logger().Error("Failed to parse rule conditions: ", "rule_id", rule.Id, "err", err)
+		logEvent(app, event.GetString("user"), rule.Id, event.Id, EventError, map[string]any{
+			"message": "invalid rule conditions, forwarding unconditionally",
+			"error":   err.Error(),
+		})
+	}
+
+	size := len(content.Subject) + len(content.Text) + len(content.Html)
+	for _, attachment := range content.Attachments {
+		size += len(attachment.Content)
+	}
+
+	index, condition := rules.Evaluate(conditions, rules.Message{
+		From:           content.From,
+		Subject:        content.Subject,
+		Headers:        content.Headers,
+		HasAttachments: len(content.Attachments) > 0,
+		Size:           size,
+	})
+
+	metadata := map[string]any{
+		"action":          condition.Action,
+		"condition_index": index,
+		"size":            size,
+	}
+	if index >= 0 {
+		metadata["condition"] = condition
+	}
+	logEvent(app, event.GetString("user"), rule.Id, event.Id, EventRuleEvaluated, metadata)
+
+	return condition
+}
+
+// conditionDestinations returns where the email goes for a forward or route
+// decision. Routed emails go to the condition's route_to address only.
+func conditionDestinations(app core.App, rule *core.Record, condition rules.Condition) ([]destination, error) {
+	if condition.Action == rules.ActionRoute {
+		return []destination{{
+			Type:      DestinationTypeEmail,
+			Recipient: condition.RouteAddress(),
+		}}, nil
+	}
+
+	return resolveDestinations(app, rule)
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"io"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/resend/resend-go/v3"
+)
+
+const (
+	SourceResend = "resend"
+	SourceSMTP   = "smtp"
+)
+
+// messageContent is the part of a received email that gets forwarded.
+type messageContent struct {
+	From        string
+	Subject     string
+	Html        string
+	Text        string
+	Headers     map[string]string
+	Attachments []*resend.Attachment
+
+	// HeaderValues keeps every instance of repeated headers, which Headers
+	// joins. It is only known for parsed raw messages.
+	HeaderValues map[string][]string
+}
+
+// loadMessageContent returns the content of the event's received email, either
+// from the raw message stored with the event or from Resend. Failures are
+// logged and reflected in the event status.
+func loadMessageContent(app core.App, event *core.Record, attempt int) (*messageContent, error) {
+	if event.GetString("raw_message") == "" {
+		content, err := fetchResendContent(app, event, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := archiveMessage(app, event, content); err != nil {
+			app.Logger().Error("Failed to archive raw message: ", "event_id", event.Id, "err", err)
+		}
+		return content, nil
+	}
+
+	raw, err := readRawMessage(app, event)
+	if err == nil {
+		var content *messageContent
+		if content, err = parseRawMessage(raw); err == nil {
+			return content, nil
+		}
+	}
+
+	app.Logger().Error("Failed to read raw message: ", "event_id", event.Id, "err", err)
+	logEvent(app, event.GetString("user"), event.GetString("rule"), event.Id, EventError, map[string]any{
+		"message": "unable to read raw message",
+		"attempt": attempt,
+	})
+	updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+		"reason": "raw_message_unreadable",
+	})
+	return nil, err
+}
+
+func fetchResendContent(app core.App, event *core.Record, attempt int) (*messageContent, error) {
+	receivedEmailId := event.GetString("received_email_id")
+
+	client, err := resendClientForEvent(app, event)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fetchResendEmail(app, event, client)
+	if err != nil {
+		app.Logger().Error("Failed to get email: ", "received_email_id", receivedEmailId, "err", err)
+		logEvent(app, event.GetString("user"), event.GetString("rule"), event.Id, EventError, map[string]any{
+			"message":           "unable to get email content",
+			"received_email_id": receivedEmailId,
+			"attempt":           attempt,
+		})
+		if isTransientError(err) && scheduleRetry(app, event, "email_content_fetch_failed", err) {
+			return nil, err
+		}
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "email_content_fetch_failed",
+		})
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// fetchResendEmail downloads the event's received email and its attachments
+// from Resend. Attachments that can't be downloaded are logged and skipped.
+func fetchResendEmail(app core.App, event *core.Record, client *resend.Client) (*messageContent, error) {
+	receivedEmailId := event.GetString("received_email_id")
+
+	email, err := client.Emails.Receiving.Get(receivedEmailId)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &messageContent{
+		From:        email.From,
+		Subject:     email.Subject,
+		Html:        email.Html,
+		Text:        email.Text,
+		Headers:     email.Headers,
+		Attachments: []*resend.Attachment{},
+	}
+
+	if len(email.Attachments) > 0 {
+		attachments, err := client.Emails.Receiving.ListAttachments(receivedEmailId)
+		if err != nil {
+			app.Logger().Error("Failed to list attachments: ", "received_email_id", receivedEmailId, "err", err)
+			logEvent(app, event.GetString("user"), event.GetString("rule"), event.Id, EventError, map[string]any{
+				"message": "failed to list attachments",
+			})
+		} else {
+			for _, attachment := range attachments.Data {
+				data, err := downloadAttachment(attachment.DownloadUrl)
+				if err != nil {
+					app.Logger().Error("Failed to download attachment", "filename", attachment.Filename, "url", attachment.DownloadUrl, "err", err)
+					continue
+				}
+
+				content.Attachments = append(content.Attachments, &resend.Attachment{
+					ContentType: attachment.ContentType,
+					Filename:    attachment.Filename,
+					Content:     data,
+					ContentId:   attachment.ContentId,
+				})
+			}
+		}
+	}
+
+	return content, nil
+}
+
+// archiveMessage stores the received email as an .eml file on the event so it
+// stays available after Resend's retention window.
+func archiveMessage(app core.App, event *core.Record, content *messageContent) error {
+	raw, err := buildRawMessage(content)
+	if err != nil {
+		return err
+	}
+
+	file, err := filesystem.NewFileFromBytes(raw, "message.eml")
+	if err != nil {
+		return err
+	}
+
+	event.Set("raw_message", file)
+	return app.Save(event)
+}
+
+// processArchiveJob archives the raw message of an event that isn't forwarded
+// right away, e.g. one held by a disabled rule, while Resend still has it.
+func processArchiveJob(app core.App, job *core.Record) error {
+	event, err := app.FindRecordById(collections.ForwardingEvents, job.GetString("event"))
+	if err != nil {
+		return err
+	}
+	if event.GetString("raw_message") != "" {
+		return nil
+	}
+
+	client, _, err := resendClientForUser(app, event.GetString("user"), event.GetString("webhook_secret"))
+	if err == nil {
+		var content *messageContent
+		if content, err = fetchResendEmail(app, event, client); err == nil {
+			err = archiveMessage(app, event, content)
+		}
+	}
+	if err != nil {
+		app.Logger().Error("Failed to archive raw message: ", "event_id", event.Id, "err", err)
+		logEvent(app, event.GetString("user"), event.GetString("rule"), event.Id, EventError, map[string]any{
+			"message": "unable to archive raw message",
+		})
+		return err
+	}
+
+	return nil
+}
+
+// readRawMessage reads the raw MIME message stored with a forwarding event.
+func readRawMessage(app core.App, event *core.Record) ([]byte, error) {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	reader, err := fsys.GetReader(event.BaseFilesPath() + "/" + event.GetString("raw_message"))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// downloadRawMessageHandler serves the archived .eml file of a forwarding event.
+func downloadRawMessageHandler(e *core.RequestEvent) error {
+	event, err := e.App.FindRecordById(collections.ForwardingEvents, e.Request.PathValue("id"))
+	if err != nil || event.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("forwarding event not found", nil)
+	}
+
+	if event.GetString("raw_message") == "" {
+		return e.NotFoundError("no raw message is stored for this forwarding event", nil)
+	}
+
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		e.App.Logger().Error("Failed to open filesystem: ", "err", err)
+		return e.InternalServerError("failed to read raw message", nil)
+	}
+	defer fsys.Close()
+
+	e.Response.Header().Set("Content-Type", "message/rfc822")
+	e.Response.Header().Set("Content-Disposition", "attachment; filename="+event.Id+".eml")
+	e.Response.Header().Set("Cache-Control", "private, no-store")
+
+	fileKey := event.BaseFilesPath() + "/" + event.GetString("raw_message")
+	if err := fsys.Serve(e.Response, e.Request, fileKey, event.Id+".eml"); err != nil {
+		e.App.Logger().Error("Failed to serve raw message: ", "event_id", event.Id, "err", err)
+		return e.NotFoundError("raw message not found", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	svix "github.com/svix/svix-webhooks/go"
+)
+
+// credentialCheck is the outcome of testing one stored credential.
+type credentialCheck struct {
+	Configured bool   `json:"configured"`
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+}
+
+// accountCheck is the outcome of testing the credentials of one Resend
+// account.
+type accountCheck struct {
+	Id            string          `json:"id"`
+	Name          string          `json:"name"`
+	APIKey        credentialCheck `json:"api_key"`
+	WebhookSecret credentialCheck `json:"webhook_secret"`
+}
+
+// testCredentialsHandler checks that the Resend API key and webhook secret of
+// every account of the user can be decrypted and used, without returning any
+// of them. Users without accounts get their default API key tested.
+func testCredentialsHandler(e *core.RequestEvent) error {
+	accounts, err := e.App.FindAllRecords(collections.ResendWebhookSecrets, dbx.HashExp{"user": e.Auth.Id})
+	if err != nil {
+		return e.InternalServerError("failed to find resend accounts", nil)
+	}
+
+	checks := []accountCheck{}
+	for _, account := range accounts {
+		checks = append(checks, accountCheck{
+			Id:            account.Id,
+			Name:          account.GetString("name"),
+			APIKey:        testResendAPIKey(e.App, e.Auth.Id, account.Id),
+			WebhookSecret: testWebhookSecret(account),
+		})
+	}
+	if len(checks) == 0 {
+		checks = append(checks, accountCheck{APIKey: testResendAPIKey(e.App, e.Auth.Id, "")})
+	}
+
+	return e.JSON(200, map[string]any{"accounts": checks})
+}
+
+// testResendAPIKey tests the API key the account sends with, the user's
+// default key when the account has none linked.
+func testResendAPIKey(app core.App, userId, accountId string) credentialCheck {
+	client, reason, err := resendClientForUser(app, userId, accountId)
+	if reason == "api_key_not_found" {
+		return credentialCheck{}
+	}
+	if err != nil {
+		return credentialCheck{Configured: true, Error: "the stored api key can't be decrypted, please set it again"}
+	}
+
+	if _, err := client.Domains.List(); err != nil {
+		return credentialCheck{Configured: true, Error: err.Error()}
+	}
+
+	return credentialCheck{Configured: true, Valid: true}
+}
+
+func testWebhookSecret(account *core.Record) credentialCheck {
+	if account.GetString("secret") == "" {
+		return credentialCheck{}
+	}
+
+	secret, err := secrets.Decrypt(account.GetString("secret"))
+	if err != nil {
+		return credentialCheck{Configured: true, Error: "the stored webhook secret can't be decrypted, please set it again"}
+	}
+
+	if _, err := svix.NewWebhook(secret); err != nil {
+		return credentialCheck{Configured: true, Error: "the webhook secret is not a valid signing secret"}
+	}
+
+	return credentialCheck{Configured: true, Valid: true}
+}
+
+// rotateWebhookURLHandler gives a Resend account a new webhook URL. The old
+// URL stops working right away, so the webhook in Resend has to be updated.
+func rotateWebhookURLHandler(e *core.RequestEvent) error {
+	account, err := e.App.FindRecordById(collections.ResendWebhookSecrets, e.Request.PathValue("id"))
+	if err != nil || account.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("webhook secret not found", nil)
+	}
+
+	account.Set("webhook_token", security.RandomString(32))
+	if err := e.App.Save(account); err != nil {
+		e.App.Logger().Error("Failed to rotate webhook url: ", "webhook_secret_id", account.Id, "err", err)
+		return e.InternalServerError("failed to rotate webhook url", nil)
+	}
+
+	return e.JSON(200, map[string]any{"webhook_token": account.GetString("webhook_token")})
+}
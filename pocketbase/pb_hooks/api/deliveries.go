@@ -0,0 +1,171 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	DestinationTypeEmail   = "email"
+	DestinationTypeWebhook = "webhook"
+)
+
+// destination is a single place a forwarded email is delivered to.
+type destination struct {
+	Id        string
+	Type      string
+	Recipient string
+}
+
+// resolveDestinations returns the rule's primary forward_to_email followed by
+// its enabled additional destinations, without duplicates. The recipient of a
+// webhook, Slack or Discord destination is its url.
+func resolveDestinations(app core.App, rule *core.Record) ([]destination, error) {
+	destinations := []destination{}
+	seen := map[string]bool{}
+
+	if primary := strings.ToLower(rule.GetString("forward_to_email")); primary != "" {
+		seen[primary] = true
+		destinations = append(destinations, destination{Type: DestinationTypeEmail, Recipient: primary})
+	}
+
+	records := []*core.Record{}
+	err := app.RecordQuery(collections.RuleDestinations).
+		AndWhere(dbx.HashExp{"rule": rule.Id, "enabled": true}).
+		OrderBy("created ASC").
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		recipient := strings.ToLower(record.GetString("email"))
+		if record.GetString("type") != DestinationTypeEmail {
+			recipient = record.GetString("url")
+		}
+		if recipient == "" || seen[recipient] {
+			continue
+		}
+		seen[recipient] = true
+		destinations = append(destinations, destination{
+			Id:        record.Id,
+			Type:      record.GetString("type"),
+			Recipient: recipient,
+		})
+	}
+
+	return destinations, nil
+}
+
+// prepareDeliveries makes sure the event has a delivery record for every
+// destination and returns them. Existing deliveries are reused so retries
+// skip recipients that were already sent to.
+func prepareDeliveries(app core.App, event, rule *core.Record, destinations []destination) ([]*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(collections.ForwardingDeliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*core.Record{}
+	for _, dest := range destinations {
+		delivery, err := app.FindFirstRecordByFilter(collection, "event = {:event} && recipient = {:recipient}", dbx.Params{
+			"event":     event.Id,
+			"recipient": dest.Recipient,
+		})
+		if err != nil {
+			delivery = core.NewRecord(collection)
+			delivery.Set("user", event.GetString("user"))
+			delivery.Set("event", event.Id)
+			delivery.Set("rule", rule.Id)
+			delivery.Set("destination", dest.Id)
+			delivery.Set("type", dest.Type)
+			delivery.Set("recipient", dest.Recipient)
+			delivery.Set("status", StatusPending)
+
+			if err := app.Save(delivery); err != nil {
+				return nil, err
+			}
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func findDeliveryBySentEmailID(app core.App, sentEmailID string) (*core.Record, error) {
+	return app.FindFirstRecordByData(collections.ForwardingDeliveries, "sent_email_id", sentEmailID)
+}
+
+// updateDeliveryStatus updates a single delivery and rolls the result up into
+// the status of its forwarding event.
+func updateDeliveryStatus(app core.App, delivery *core.Record, status string, errorData map[string]any) error {
+	delivery.Set("status", status)
+	if errorData != nil {
+		delivery.Set("error", errorData)
+	}
+
+	if err := app.Save(delivery); err != nil {
+		return err
+	}
+
+	return refreshForwardingEventStatus(app, delivery.GetString("event"))
+}
+
+// refreshForwardingEventStatus derives the event status from its deliveries:
+// delivered, bounced or failed once every delivery agrees, partial when some
+// failed or bounced and the others went out, then complained or delayed when
+// any delivery is, and sent otherwise. Events that still have pending
+// deliveries keep their current status.
+func refreshForwardingEventStatus(app core.App, eventId string) error {
+	deliveries, err := app.FindAllRecords(collections.ForwardingDeliveries, dbx.HashExp{"event": eventId})
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+
+	counts := map[string]int{}
+	var lastError any
+	for _, delivery := range deliveries {
+		counts[delivery.GetString("status")]++
+		if status := delivery.GetString("status"); status == StatusFailed || status == StatusBounced {
+			lastError = delivery.Get("error")
+		}
+	}
+
+	if counts[StatusPending] > 0 {
+		return nil
+	}
+
+	undelivered := counts[StatusFailed] + counts[StatusBounced]
+
+	status := StatusSent
+	switch {
+	case counts[StatusDelivered] == len(deliveries):
+		status = StatusDelivered
+	case counts[StatusBounced] == len(deliveries):
+		status = StatusBounced
+	case undelivered == len(deliveries):
+		status = StatusFailed
+	case undelivered > 0:
+		status = StatusPartial
+	case counts[StatusComplained] > 0:
+		status = StatusComplained
+	case counts[StatusDelayed] > 0:
+		status = StatusDelayed
+	}
+
+	event, err := app.FindRecordById(collections.ForwardingEvents, eventId)
+	if err != nil {
+		return err
+	}
+
+	event.Set("status", status)
+	if lastError != nil {
+		event.Set("error", lastError)
+	}
+
+	return app.Save(event)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	DisabledActionDrop   = "drop"
+	DisabledActionHold   = "hold"
+	DisabledActionBounce = "bounce"
+)
+
+// disabledDisposition returns what happens to mail received by a disabled
+// rule: the action, the initial event status and the job to queue, if any.
+// Held mail is archived so it can still be released later. Rules without a
+// configured action drop their mail.
+func disabledDisposition(rule *core.Record) (string, string, string) {
+	switch rule.GetString("disabled_action") {
+	case DisabledActionHold:
+		return DisabledActionHold, StatusHeld, jobs.TypeArchive
+	case DisabledActionBounce:
+		return DisabledActionBounce, StatusPending, jobs.TypeBounce
+	default:
+		return DisabledActionDrop, StatusDropped, ""
+	}
+}
+
+// bouncesAtSMTP reports whether the SMTP listener should reject mail for the
+// match instead of accepting it and sending a bounce notice later.
+func bouncesAtSMTP(app core.App, match ruleMatch) bool {
+	if match.Type == MatchReverseAlias {
+		return false
+	}
+
+	rule := match.Rule
+	if rule.GetBool("enabled") && !isSuppressed(app, rule.GetString("user"), rule.GetString("forward_to_email")) {
+		return false
+	}
+
+	action, _, _ := disabledDisposition(rule)
+	return action == DisabledActionBounce
+}
+
+// skipBounceReason returns why no bounce notice may be sent for an email, ""
+// when one may. The From header is easily forged, so notices only go to
+// senders that didn't fail authentication and don't look automated, anything
+// else would send backscatter to whoever was impersonated. Mail received by
+// the SMTP listener is rejected there instead, its sender is never verified.
+func skipBounceReason(event *core.Record, content *messageContent) string {
+	if event.GetString("source") == SourceSMTP {
+		return "unverified_sender"
+	}
+
+	from, err := mail.ParseAddress(content.From)
+	if err != nil || from.Address == "" {
+		return "missing_sender"
+	}
+
+	local, _ := splitAddress(strings.ToLower(from.Address))
+	for _, prefix := range noReplyPrefixes {
+		if strings.HasPrefix(local, prefix) {
+			return "no_reply_sender"
+		}
+	}
+
+	results := parseAuthResults(content, trustedAuthservIDs())
+	if results.DMARC == authResultFail || results.SPF == authResultFail || results.SPF == "softfail" {
+		return "sender_authentication_failed"
+	}
+
+	precedence := strings.ToLower(strings.TrimSpace(headerValue(content, "Precedence")))
+	autoSubmitted := strings.ToLower(strings.TrimSpace(headerValue(content, "Auto-Submitted")))
+	switch {
+	case precedence == "bulk" || precedence == "list" || precedence == "junk",
+		autoSubmitted != "" && autoSubmitted != "no",
+		headerValue(content, "List-Id") != "",
+		headerValue(content, "List-Unsubscribe") != "":
+		return "bulk_sender"
+	}
+
+	return ""
+}
+
+// bounceContent reads the headers of a bounced email from its raw message,
+// archiving it first when it was received through Resend. Unlike
+// loadMessageContent it never schedules a retry, which would forward it.
+func bounceContent(app core.App, event *core.Record) (*messageContent, error) {
+	if event.GetString("raw_message") != "" {
+		raw, err := readRawMessage(app, event)
+		if err != nil {
+			return nil, err
+		}
+		return parseRawMessage(raw)
+	}
+
+	client, _, err := resendClientForUser(app, event.GetString("user"), event.GetString("webhook_secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fetchResendEmail(app, event, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := archiveMessage(app, event, content); err != nil {
+		app.Logger().Error("Failed to archive raw message: ", "event_id", event.Id, "err", err)
+	}
+	return content, nil
+}
+
+// noReplyPrefixes are the local parts of addresses that don't read replies.
+var noReplyPrefixes = []string{"noreply", "no-reply", "no_reply", "donotreply", "do-not-reply", "mailer-daemon", "postmaster", "bounce"}
+
+// processBounceJob tells the sender of an email received by a disabled rule
+// that their message was not delivered, unless skipBounceReason says the
+// sender can't be trusted.
+func processBounceJob(app core.App, job *core.Record) error {
+	event, err := app.FindRecordById(collections.ForwardingEvents, job.GetString("event"))
+	if err != nil {
+		return err
+	}
+
+	rule, err := app.FindRecordById(collections.ForwardingRules, event.GetString("rule"))
+	if err != nil {
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "rule_not_found",
+		})
+		return err
+	}
+
+	content, err := bounceContent(app, event)
+	if err != nil {
+		app.Logger().Error("Failed to read bounced message: ", "event_id", event.Id, "err", err)
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "email_content_fetch_failed",
+		})
+		return err
+	}
+
+	if reason := skipBounceReason(event, content); reason != "" {
+		return updateForwardingEventStatus(app, event.Id, StatusDropped, "", map[string]any{
+			"reason":        "bounce_skipped",
+			"bounce_reason": reason,
+		})
+	}
+
+	sender, err := senderForEvent(app, event, rule)
+	if err != nil {
+		return err
+	}
+
+	bounceEmailId, err := sender.Send(&OutboundEmail{
+		From:    rule.GetString("send_from_email"),
+		To:      event.GetString("from"),
+		Subject: "Undeliverable: " + event.GetString("subject"),
+		Text: "Your message to " + event.GetString("to") + " could not be delivered " +
+			"because this address is not accepting mail at the moment.",
+	})
+	if err != nil {
+		app.Logger().Error("Failed to send bounce notice: ", "event_id", event.Id, "err", err)
+		logEvent(app, event.GetString("user"), rule.Id, event.Id, EventError, map[string]any{
+			"message": "failed to send bounce notice",
+			"error":   err.Error(),
+		})
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "bounce_send_failed",
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	logEvent(app, event.GetString("user"), rule.Id, event.Id, EventBounceSent, map[string]any{
+		"bounce_email_id": bounceEmailId,
+		"to":              event.GetString("from"),
+	})
+
+	return updateForwardingEventStatus(app, event.Id, StatusReturned, "", nil)
+}
+
+// releaseForwardingEventHandler forwards a held event using the rule's
+// current settings.
+func releaseForwardingEventHandler(e *core.RequestEvent) error {
+	event, err := e.App.FindRecordById(collections.ForwardingEvents, e.Request.PathValue("id"))
+	if err != nil || event.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("forwarding event not found", nil)
+	}
+
+	if event.GetString("status") != StatusHeld {
+		return e.BadRequestError("only held forwarding events can be released", nil)
+	}
+
+	if _, err := e.App.FindRecordById(collections.ForwardingRules, event.GetString("rule")); err != nil {
+		return e.BadRequestError("the forwarding rule for this event no longer exists", nil)
+	}
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		event.Set("status", StatusPending)
+		if err := txApp.Save(event); err != nil {
+			return err
+		}
+
+		logEvent(txApp, event.GetString("user"), event.GetString("rule"), event.Id, EventForwardReleased, map[string]any{
+			"received_email_id": event.GetString("received_email_id"),
+		})
+
+		_, err := jobs.Enqueue(txApp, jobs.TypeForward, event.GetString("user"), event.Id)
+		return err
+	})
+	if err != nil {
+		e.App.Logger().Error("Failed to release forwarding event: ", "event_id", event.Id, "err", err)
+		return e.InternalServerError("failed to release forwarding event", nil)
+	}
+
+	return e.JSON(200, map[string]any{"id": event.Id})
+}
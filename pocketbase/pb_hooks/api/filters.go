@@ -0,0 +1,58 @@
+package api
+
+import (
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// checkSenderFilters runs the sender through the allow and block lists of the
+// rule and of the rule's account.
+func checkSenderFilters(app core.App, rule *core.Record, from string) (bool, *core.Record, error) {
+	filters, err := app.FindRecordsByFilter(
+		collections.SenderFilters,
+		"user = {:user} && (rule = '' || rule = {:rule})",
+		"created",
+		0,
+		0,
+		dbx.Params{"user": rule.GetString("user"), "rule": rule.Id},
+	)
+	if err != nil || len(filters) == 0 {
+		return false, nil, err
+	}
+
+	ruleFilters := []*core.Record{}
+	accountFilters := []*core.Record{}
+	for _, filter := range filters {
+		if filter.GetString("rule") == "" {
+			accountFilters = append(accountFilters, filter)
+		} else {
+			ruleFilters = append(ruleFilters, filter)
+		}
+	}
+
+	blocked, filter := rules.FilterSender(ruleFilters, accountFilters, from)
+	return blocked, filter, nil
+}
+
+// senderFilterMetadata describes the entry that blocked a sender, or the
+// missing allow entry when no entry matched.
+func senderFilterMetadata(filter *core.Record) map[string]any {
+	if filter == nil {
+		return map[string]any{"reason": "not_allowed"}
+	}
+
+	scope := "account"
+	if filter.GetString("rule") != "" {
+		scope = "rule"
+	}
+
+	return map[string]any{
+		"reason":  "blocked",
+		"id":      filter.Id,
+		"scope":   scope,
+		"action":  filter.GetString("action"),
+		"pattern": filter.GetString("pattern"),
+	}
+}
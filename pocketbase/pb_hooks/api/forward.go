@@ -0,0 +1,290 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/resend/resend-go/v3"
+)
+
+var attachmentClient = &http.Client{Timeout: 60 * time.Second}
+
+// processForwardJob loads the received email referenced by the job's
+// forwarding event, evaluates the rule's conditions and authentication policy
+// and sends it to the resulting destinations.
+func processForwardJob(app core.App, job *core.Record) error {
+	event, err := app.FindRecordById(collections.ForwardingEvents, job.GetString("event"))
+	if err != nil {
+		return err
+	}
+
+	rule, err := app.FindRecordById(collections.ForwardingRules, event.GetString("rule"))
+	if err != nil {
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "rule_not_found",
+		})
+		return err
+	}
+
+	userId := event.GetString("user")
+	receivedEmailId := event.GetString("received_email_id")
+
+	attempt := event.GetInt("attempts") + 1
+	event.Set("attempts", attempt)
+	if err := app.Save(event); err != nil {
+		return err
+	}
+
+	content, err := loadMessageContent(app, event, attempt)
+	if err != nil {
+		return err
+	}
+
+	if isReplyEvent(event) {
+		return forwardReply(app, event, rule, content, attempt)
+	}
+
+	condition := evaluateConditions(app, event, rule, content)
+	if condition.Action == rules.ActionDrop {
+		updateForwardingEventStatus(app, event.Id, StatusDropped, "", nil)
+		return nil
+	}
+
+	switch checkAuthentication(app, event, rule, content) {
+	case AuthPolicyQuarantine:
+		if releasedFromQuarantine(event) {
+			break
+		}
+
+		updateForwardingEventStatus(app, event.Id, StatusQuarantined, "", nil)
+		if err := quarantineMessage(app, userId, rule.Id, event.Id, QuarantineReasonAuthFailed, map[string]any{
+			"authentication": event.Get("authentication"),
+		}); err != nil {
+			app.Logger().Error("Failed to quarantine message: ", "event_id", event.Id, "err", err)
+		}
+		return nil
+	case AuthPolicyTag:
+		content.Subject = authFailedSubjectTag + content.Subject
+	}
+
+	logEvent(app, userId, rule.Id, event.Id, EventForwardInitiated, map[string]any{
+		"received_email_id": receivedEmailId,
+		"subject":           event.GetString("subject"),
+		"attempt":           attempt,
+	})
+
+	var deliveries []*core.Record
+	destinations, err := conditionDestinations(app, rule, condition)
+	if err == nil {
+		deliveries, err = prepareDeliveries(app, event, rule, destinations)
+	}
+	if err != nil {
+		app.Logger().Error("Failed to prepare deliveries: ", "event_id", event.Id, "err", err)
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "deliveries_preparation_failed",
+		})
+		return err
+	}
+
+	sender, err := senderForEvent(app, event, rule)
+	if err != nil {
+		return err
+	}
+
+	sendFromEmail := rule.GetString("send_from_email")
+
+	replyTo := content.From
+	if rule.GetBool("reply_through") {
+		if replyTo, err = reverseAliasReplyTo(app, rule, content.From); err != nil {
+			app.Logger().Error("Failed to create reverse alias: ", "rule_id", rule.Id, "err", err)
+			updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+				"reason": "reverse_alias_failed",
+			})
+			return err
+		}
+	}
+
+	var sendErr error
+	retry, retryReason := false, ""
+	for _, delivery := range deliveries {
+		if delivery.GetString("status") != StatusPending {
+			continue
+		}
+
+		recipient := delivery.GetString("recipient")
+		if isSuppressed(app, userId, recipient) {
+			delivery.Set("status", StatusFailed)
+			delivery.Set("error", map[string]any{"reason": "recipient_suppressed"})
+			if err := app.Save(delivery); err != nil {
+				app.Logger().Error("Failed to update delivery: ", "delivery_id", delivery.Id, "err", err)
+			}
+			continue
+		}
+
+		status, sentEmailId := StatusSent, ""
+		message, reason := "failed to send email", "email_send_failed"
+
+		switch delivery.GetString("type") {
+		case DestinationTypeWebhook:
+			// a 2xx response means the payload arrived, no delivery webhook follows
+			status = StatusDelivered
+			message, reason = "failed to deliver webhook", "webhook_delivery_failed"
+			err = deliverWebhook(app, event, rule, delivery, content, attempt)
+		case DestinationTypeSlack, DestinationTypeDiscord:
+			status = StatusDelivered
+			message, reason = "failed to post chat message", "chat_delivery_failed"
+			err = deliverChatMessage(app, event, rule, delivery, content, attempt)
+		default:
+			sentEmailId, err = sender.Send(&OutboundEmail{
+				From:        sendFromEmail,
+				To:          recipient,
+				Subject:     content.Subject,
+				Html:        content.Html,
+				Text:        content.Text,
+				Attachments: content.Attachments,
+				ReplyTo:     replyTo,
+			})
+		}
+		if err != nil {
+			app.Logger().Error("Failed to deliver forward: ", "recipient", recipient, "err", err)
+			logEvent(app, userId, rule.Id, event.Id, EventError, map[string]any{
+				"message":   message,
+				"recipient": recipient,
+				"error":     err.Error(),
+				"attempt":   attempt,
+			})
+
+			sendErr = err
+			errorData := map[string]any{
+				"reason": reason,
+				"error":  err.Error(),
+			}
+			if isTransientError(err) {
+				retry, retryReason = true, reason
+				delivery.Set("error", errorData)
+				if err := app.Save(delivery); err != nil {
+					app.Logger().Error("Failed to update delivery: ", "delivery_id", delivery.Id, "err", err)
+				}
+				continue
+			}
+
+			delivery.Set("status", StatusFailed)
+			delivery.Set("error", errorData)
+			if err := app.Save(delivery); err != nil {
+				app.Logger().Error("Failed to update delivery: ", "delivery_id", delivery.Id, "err", err)
+			}
+			continue
+		}
+
+		delivery.Set("status", status)
+		delivery.Set("sent_email_id", sentEmailId)
+		if err := app.Save(delivery); err != nil {
+			app.Logger().Error("Failed to update delivery: ", "delivery_id", delivery.Id, "err", err)
+		}
+
+		if sentEmailId != "" && event.GetString("sent_email_id") == "" {
+			event.Set("sent_email_id", sentEmailId)
+			if err := app.Save(event); err != nil {
+				app.Logger().Error("Failed to update forwarding event: ", "err", err)
+			}
+		}
+	}
+
+	if retry {
+		if scheduleRetry(app, event, retryReason, sendErr) {
+			return sendErr
+		}
+
+		// out of attempts, give up on the recipients that are still pending
+		for _, delivery := range deliveries {
+			if delivery.GetString("status") == StatusPending {
+				delivery.Set("status", StatusFailed)
+				if err := app.Save(delivery); err != nil {
+					app.Logger().Error("Failed to update delivery: ", "delivery_id", delivery.Id, "err", err)
+				}
+			}
+		}
+	}
+
+	if err := refreshForwardingEventStatus(app, event.Id); err != nil {
+		app.Logger().Error("Failed to update forwarding event status: ", "err", err)
+	}
+
+	return sendErr
+}
+
+// resendClientForEvent returns a Resend client authenticated with the API key
+// of the event's user. Missing or undecryptable keys fail the event.
+func resendClientForEvent(app core.App, event *core.Record) (*resend.Client, error) {
+	userId := event.GetString("user")
+
+	client, reason, err := resendClientForUser(app, userId, event.GetString("webhook_secret"))
+	if err != nil {
+		message := "resend api key not found"
+		if reason == "api_key_decryption_failed" {
+			message = "unable to decrypt resend api key"
+		}
+
+		logEvent(app, userId, event.GetString("rule"), event.Id, EventError, map[string]any{
+			"message": message,
+		})
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": reason,
+		})
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// resendClientForUser returns a Resend client for the API key of the given
+// Resend account, falling back to the user's first API key when no account is
+// given or it has no key linked. On failure it also returns the reason,
+// api_key_not_found or api_key_decryption_failed.
+func resendClientForUser(app core.App, userId, accountId string) (*resend.Client, string, error) {
+	apiKeyRecord, err := findResendAPIKey(app, userId, accountId)
+	if err != nil {
+		app.Logger().Error("Failed to find Resend API key for user: ", "user_id", userId, "err", err)
+		return nil, "api_key_not_found", err
+	}
+
+	encryptedKey := apiKeyRecord.GetString("key")
+	apiKey, err := secrets.Decrypt(encryptedKey)
+	if err != nil {
+		app.Logger().Error("Failed to decrypt Resend API key: ", "user_id", userId, "err", err)
+		return nil, "api_key_decryption_failed", err
+	}
+
+	return newResendClient(apiKey), "", nil
+}
+
+func findResendAPIKey(app core.App, userId, accountId string) (*core.Record, error) {
+	if accountId != "" {
+		account, err := app.FindRecordById(collections.ResendWebhookSecrets, accountId)
+		if err == nil && account.GetString("api_key") != "" {
+			return app.FindRecordById(collections.ResendAPIKeys, account.GetString("api_key"))
+		}
+	}
+
+	return app.FindFirstRecordByData(collections.ResendAPIKeys, "user", userId)
+}
+
+func downloadAttachment(url string) ([]byte, error) {
+	resp, err := attachmentClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status " + resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// recordingResponseWriter keeps a copy of the status and body written by a
+// webhook handler so the outcome can be replayed for redeliveries.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withIdempotency runs handler at most once per svix-id and per webhook type
+// and email id, within the scope of the accounts that verified the webhook.
+// Redeliveries of an already processed webhook get the stored response back
+// without running the handler again. Scoping keeps webhooks one account signs
+// from claiming the keys of another account's webhooks.
+func withIdempotency(e *core.RequestEvent, accounts verifiedAccounts, webhookType, emailId string, handler func() error) error {
+	svixId := e.Request.Header.Get("svix-id")
+	if svixId == "" {
+		return e.JSON(400, map[string]any{"error": "missing svix-id header"})
+	}
+
+	scope := receiptScope(accounts)
+
+	existing, err := findWebhookReceipt(e.App, scope, svixId, webhookType, emailId)
+	if err == nil {
+		return replayWebhookReceipt(e, existing)
+	}
+
+	receipt, err := claimWebhookReceipt(e.App, scope, svixId, webhookType, emailId)
+	if err != nil {
+		if existing, findErr := findWebhookReceipt(e.App, scope, svixId, webhookType, emailId); findErr == nil {
+			return replayWebhookReceipt(e, existing)
+		}
+		e.App.Logger().Error("Failed to record webhook receipt: ", "svix_id", svixId, "err", err)
+		return e.JSON(500, map[string]any{"error": "failed to record webhook receipt"})
+	}
+
+	recorder := &recordingResponseWriter{ResponseWriter: e.Response}
+	e.Response = recorder
+	handlerErr := handler()
+	e.Response = recorder.ResponseWriter
+
+	// server errors and signature failures are not final, so let the
+	// redelivery run the handler again instead of replaying them
+	if handlerErr != nil || recorder.status >= 500 || recorder.status == http.StatusUnauthorized {
+		if err := e.App.Delete(receipt); err != nil {
+			e.App.Logger().Error("Failed to release webhook receipt: ", "svix_id", svixId, "err", err)
+		}
+		return handlerErr
+	}
+
+	receipt.Set("status_code", recorder.status)
+	if body := bytes.TrimSpace(recorder.body.Bytes()); len(body) > 0 && json.Valid(body) {
+		receipt.Set("response", json.RawMessage(body))
+	}
+	if err := e.App.Save(receipt); err != nil {
+		e.App.Logger().Error("Failed to save webhook receipt outcome: ", "svix_id", svixId, "err", err)
+	}
+
+	return nil
+}
+
+// receiptScope returns the sorted ids of the accounts that verified a webhook.
+func receiptScope(accounts verifiedAccounts) string {
+	ids := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.Id)
+	}
+	slices.Sort(ids)
+
+	return strings.Join(ids, ",")
+}
+
+func findWebhookReceipt(app core.App, scope, svixId, webhookType, emailId string) (*core.Record, error) {
+	exps := []dbx.Expression{dbx.HashExp{"svix_id": svixId}}
+	if emailId != "" {
+		exps = append(exps, dbx.HashExp{"type": webhookType, "email_id": emailId})
+	}
+
+	records, err := app.FindAllRecords(collections.WebhookReceipts, dbx.HashExp{"scope": scope}, dbx.Or(exps...))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return records[0], nil
+}
+
+func claimWebhookReceipt(app core.App, scope, svixId, webhookType, emailId string) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(collections.WebhookReceipts)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := core.NewRecord(collection)
+	receipt.Set("scope", scope)
+	receipt.Set("svix_id", svixId)
+	receipt.Set("type", webhookType)
+	receipt.Set("email_id", emailId)
+
+	if err := app.Save(receipt); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+func replayWebhookReceipt(e *core.RequestEvent, receipt *core.Record) error {
+	status := receipt.GetInt("status_code")
+	if status == 0 {
+		return e.JSON(409, map[string]any{"error": "webhook is already being processed"})
+	}
+
+	var response any
+	if raw := receipt.GetString("response"); raw != "" {
+		response = json.RawMessage(raw)
+	}
+
+	return e.JSON(status, response)
+}
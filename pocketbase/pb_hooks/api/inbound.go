@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/smtpd"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// receiveSMTPMessage runs a message accepted by the SMTP listener through the
+// same rule lookup and forwarding path as Resend's email.received webhook. The
+// envelope recipients decide which rules match, the raw message is stored
+// with the forwarding events so the worker doesn't need Resend to read it.
+func receiveSMTPMessage(app core.App, envelope *smtpd.Envelope) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(envelope.Data))
+	if err != nil {
+		return &smtpd.Error{Code: 554, Message: "malformed message"}
+	}
+
+	recipients := collectRecipients(envelope.Recipients)
+	matches, err := findMatchingRules(app, recipients, "")
+	if err != nil {
+		app.Logger().Error("Failed to look up forwarding rules: ", "recipients", recipients, "err", err)
+		return err
+	}
+	if len(matches) == 0 {
+		app.Logger().Error("Failed to find forwarding rule: ", "recipients", recipients)
+		return &smtpd.Error{Code: 550, Message: "no such recipient"}
+	}
+
+	// the sender of SMTP mail is never verified, so mail that would only be
+	// bounced is rejected right away instead of sending a notice later
+	bounced := 0
+	for _, match := range matches {
+		if bouncesAtSMTP(app, match) {
+			bounced++
+		}
+	}
+	if bounced == len(matches) {
+		return &smtpd.Error{Code: 550, Message: "mailbox unavailable"}
+	}
+
+	subject, err := (&mime.WordDecoder{}).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	from := msg.Header.Get("From")
+	if from == "" {
+		from = envelope.From
+	}
+
+	to := headerAddresses(msg.Header, "To")
+	cc := headerAddresses(msg.Header, "Cc")
+
+	// envelope recipients missing from the headers were blind copied
+	listed := map[string]bool{}
+	for _, address := range collectRecipients(to, cc) {
+		listed[address] = true
+	}
+	bcc := []string{}
+	for _, recipient := range recipients {
+		if !listed[recipient] {
+			bcc = append(bcc, recipient)
+		}
+	}
+
+	id := strings.Trim(msg.Header.Get("Message-ID"), "<> ")
+	if id == "" {
+		id = security.RandomString(32)
+	}
+
+	return queueForwardingEvents(app, &inboundEmail{
+		ID:      id,
+		Source:  SourceSMTP,
+		From:    from,
+		Subject: subject,
+		To:      to,
+		Cc:      cc,
+		Bcc:     bcc,
+		Raw:     envelope.Data,
+	}, matches)
+}
+
+func headerAddresses(header mail.Header, key string) []string {
+	list, err := header.AddressList(key)
+	if err != nil {
+		return []string{}
+	}
+
+	addresses := make([]string, 0, len(list))
+	for _, address := range list {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
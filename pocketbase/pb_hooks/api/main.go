@@ -3,15 +3,14 @@ package api
 import (
 	"encoding/json"
 	"io"
-	"net/http"
-	"os"
 
 	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/smtpd"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tools/security"
-	"github.com/resend/resend-go/v3"
-	svix "github.com/svix/svix-webhooks/go"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
 )
 
 const (
@@ -21,347 +20,648 @@ const (
 	EventEmailDelivered   = "email.delivered"
 	EventEmailFailed      = "email.failed"
 	EventError            = "error"
-
-	WebhookTypeReceived  = "email.received"
-	WebhookTypeSent      = "email.sent"
-	WebhookTypeDelivered = "email.delivered"
-	WebhookTypeFailed    = "email.failed"
-
-	StatusPending   = "pending"
-	StatusSent      = "sent"
-	StatusDelivered = "delivered"
-	StatusFailed    = "failed"
+	EventForwardRetrying  = "forward.retrying"
+	EventForwardReplayed  = "forward.replayed"
+	EventRuleEvaluated    = "rule.evaluated"
+	EventRuleDisabled     = "rule.disabled"
+	EventForwardReleased  = "forward.released"
+	EventBounceSent       = "bounce.sent"
+	EventWebhookResponse  = "webhook.response"
+	EventEmailBounced     = "email.bounced"
+	EventEmailComplained  = "email.complained"
+	EventEmailDelayed     = "email.delivery_delayed"
+	EventEmailOpened      = "email.opened"
+	EventEmailClicked     = "email.clicked"
+
+	EventRecipientSuppressed   = "recipient.suppressed"
+	EventRecipientUnsuppressed = "recipient.unsuppressed"
+	EventSenderBlocked         = "sender.blocked"
+	EventAuthFailed            = "auth.failed"
+	EventMessageQuarantined    = "message.quarantined"
+	EventQuarantineDeleted     = "quarantine.deleted"
+	EventReplySent             = "reply.sent"
+	EventReplyRejected         = "reply.rejected"
+
+	WebhookTypeReceived   = "email.received"
+	WebhookTypeSent       = "email.sent"
+	WebhookTypeDelivered  = "email.delivered"
+	WebhookTypeFailed     = "email.failed"
+	WebhookTypeBounced    = "email.bounced"
+	WebhookTypeComplained = "email.complained"
+	WebhookTypeDelayed    = "email.delivery_delayed"
+	WebhookTypeOpened     = "email.opened"
+	WebhookTypeClicked    = "email.clicked"
+
+	StatusPending     = "pending"
+	StatusSent        = "sent"
+	StatusDelivered   = "delivered"
+	StatusFailed      = "failed"
+	StatusRetrying    = "retrying"
+	StatusPartial     = "partial"
+	StatusDropped     = "dropped"
+	StatusHeld        = "held"
+	StatusBounced     = "bounced"
+	StatusComplained  = "complained"
+	StatusDelayed     = "delayed"
+	StatusBlocked     = "blocked"
+	StatusQuarantined = "quarantined"
+	StatusReturned    = "returned"
 )
 
 func Init(app *pocketbase.PocketBase) error {
+	jobs.Register(jobs.TypeForward, processForwardJob)
+	jobs.Register(jobs.TypeBounce, processBounceJob)
+	jobs.Register(jobs.TypeArchive, processArchiveJob)
+	smtpd.Register(receiveSMTPMessage)
+
+	app.OnRecordAfterDeleteSuccess(collections.Suppressions).BindFunc(func(e *core.RecordEvent) error {
+		if err := unsuppressRecipient(e.App, e.Record); err != nil {
+			e.App.Logger().Error("Failed to resume suppressed forwarding: ", "suppression_id", e.Record.Id, "err", err)
+		}
+
+		return e.Next()
+	})
+
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		v1 := se.Router.Group("/api")
 		v1.POST("/webhooks/resend", resendWebhookHandler)
+		v1.POST("/webhooks/resend/{token}", accountWebhookHandler)
+		v1.POST("/forwarding-events/{id}/replay", replayForwardingEventHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.POST("/forwarding-events/{id}/release", releaseForwardingEventHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.GET("/forwarding-events/{id}/raw", downloadRawMessageHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.GET("/forwarding-events/{id}/attachments/{index}", downloadAttachmentHandler)
+		v1.GET("/authentication/status", authenticationStatusHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.POST("/credentials/test", testCredentialsHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.POST("/quarantine/{id}/release", releaseQuarantineHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.DELETE("/quarantine/{id}", deleteQuarantineHandler).Bind(apis.RequireAuth(collections.Users))
+		v1.POST("/webhook-secrets/{id}/rotate-url", rotateWebhookURLHandler).Bind(apis.RequireAuth(collections.Users))
 
 		return se.Next()
 	})
 	return nil
 }
 
-func resendWebhookHandler(e *core.RequestEvent) error {
-	var basePayload struct {
-		Type string `json:"type"`
+// accountWebhookHandler receives the Resend webhooks of the account the token
+// in the URL belongs to. The signature is verified before anything is stored,
+// so unsigned or forged requests only end up in the security audit log.
+func accountWebhookHandler(e *core.RequestEvent) error {
+	bodyBytes, err := io.ReadAll(e.Request.Body)
+	if err != nil {
+		e.App.Logger().Error("Failed to read request body: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "failed to read request body"})
+	}
+
+	token := e.Request.PathValue("token")
+	account, err := e.App.FindFirstRecordByData(collections.ResendWebhookSecrets, "webhook_token", token)
+	if token == "" || err != nil {
+		auditRejectedWebhook(e, "", RejectedUnknownToken, bodyBytes)
+		return e.JSON(404, map[string]any{"error": rejectionMessages[RejectedUnknownToken]})
+	}
+
+	userId := account.GetString("user")
+	if status, reason := verifyWebhookSignature(e, account, bodyBytes); status != 0 {
+		auditRejectedWebhook(e, userId, reason, bodyBytes)
+		return e.JSON(status, map[string]any{"error": rejectionMessages[reason]})
 	}
 
+	return handleWebhook(e, verifiedAccounts{userId: account}, bodyBytes)
+}
+
+// resendWebhookHandler receives webhooks on the endpoint shared by all
+// accounts. The users a webhook may belong to are looked up from its payload,
+// and it is only handled for those with an account whose secret verifies it.
+func resendWebhookHandler(e *core.RequestEvent) error {
 	bodyBytes, err := io.ReadAll(e.Request.Body)
 	if err != nil {
 		e.App.Logger().Error("Failed to read request body: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "failed to read request body"})
 	}
 
+	var basePayload webhookEnvelope
+	if err := json.Unmarshal(bodyBytes, &basePayload); err != nil {
+		e.App.Logger().Error("Failed to parse webhook type: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
+	}
+
+	candidates, err := webhookUsers(e.App, basePayload.Type, bodyBytes)
+	if err != nil {
+		e.App.Logger().Error("Failed to look up webhook users: ", "type", basePayload.Type, "err", err)
+		return e.JSON(500, map[string]any{"error": "failed to look up webhook users"})
+	}
+	if len(candidates) == 0 {
+		if basePayload.Type == WebhookTypeReceived {
+			return e.JSON(404, map[string]any{"error": "forwarding rule not found"})
+		}
+		return e.JSON(200, nil)
+	}
+
+	accounts := verifiedAccounts{}
+	rejections := map[string]string{}
+	failureStatus, failureReason := 0, ""
+	for _, userId := range candidates {
+		account, status, reason := verifyUserWebhookSignature(e, userId, bodyBytes)
+		if status != 0 {
+			rejections[userId] = reason
+			failureStatus, failureReason = status, reason
+			continue
+		}
+		accounts[userId] = account
+	}
+	// a webhook verified by one user is expected to fail for the others it
+	// shares recipients with, so only fully rejected requests are audited
+	if len(accounts) == 0 {
+		for userId, reason := range rejections {
+			auditRejectedWebhook(e, userId, reason, bodyBytes)
+		}
+		return e.JSON(failureStatus, map[string]any{"error": rejectionMessages[failureReason]})
+	}
+
+	return handleWebhook(e, accounts, bodyBytes)
+}
+
+// handleWebhook processes a verified webhook for the given accounts.
+func handleWebhook(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var basePayload webhookEnvelope
 	if err := json.Unmarshal(bodyBytes, &basePayload); err != nil {
 		e.App.Logger().Error("Failed to parse webhook type: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
 	switch basePayload.Type {
+	case WebhookTypeReceived, WebhookTypeSent, WebhookTypeDelivered, WebhookTypeFailed,
+		WebhookTypeBounced, WebhookTypeComplained:
+		return withIdempotency(e, accounts, basePayload.Type, basePayload.Data.EmailID, func() error {
+			return dispatchWebhook(e, accounts, basePayload.Type, bodyBytes)
+		})
+	case WebhookTypeDelayed, WebhookTypeOpened, WebhookTypeClicked:
+		// an email can be delayed, opened and clicked many times, so only
+		// the svix-id identifies a redelivery
+		return withIdempotency(e, accounts, basePayload.Type, "", func() error {
+			return dispatchWebhook(e, accounts, basePayload.Type, bodyBytes)
+		})
+	default:
+		e.App.Logger().Warn("Unknown webhook type: ", "type", basePayload.Type)
+		return e.JSON(200, nil)
+	}
+}
+
+func dispatchWebhook(e *core.RequestEvent, accounts verifiedAccounts, webhookType string, bodyBytes []byte) error {
+	switch webhookType {
 	case WebhookTypeReceived:
-		return handleEmailReceived(e, bodyBytes)
+		return handleEmailReceived(e, accounts, bodyBytes)
 	case WebhookTypeSent:
-		return handleEmailSent(e, bodyBytes)
+		return handleEmailSent(e, accounts, bodyBytes)
 	case WebhookTypeDelivered:
-		return handleEmailDelivered(e, bodyBytes)
+		return handleEmailDelivered(e, accounts, bodyBytes)
 	case WebhookTypeFailed:
-		return handleEmailFailed(e, bodyBytes)
+		return handleEmailFailed(e, accounts, bodyBytes)
+	case WebhookTypeBounced:
+		return handleEmailBounced(e, accounts, bodyBytes)
+	case WebhookTypeComplained:
+		return handleEmailComplained(e, accounts, bodyBytes)
+	case WebhookTypeDelayed:
+		return handleEmailDeliveryDelayed(e, accounts, bodyBytes)
+	case WebhookTypeOpened:
+		return handleEmailOpened(e, accounts, bodyBytes)
+	case WebhookTypeClicked:
+		return handleEmailClicked(e, accounts, bodyBytes)
 	default:
-		e.App.Logger().Warn("Unknown webhook type: ", "type", basePayload.Type)
 		return e.JSON(200, nil)
 	}
 }
 
-func handleEmailReceived(e *core.RequestEvent, bodyBytes []byte) error {
+// handleEmailReceived queues the forwards of a received email for the rules
+// of the accounts the webhook was verified for.
+func handleEmailReceived(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
 	var payload EmailReceivedWebhook
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
 		e.App.Logger().Error("Failed to parse email.received payload: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	ruleEmail := payload.Data.To[0]
-	rule, err := e.App.FindFirstRecordByData(collections.ForwardingRules, "rule_email", ruleEmail)
-	if err != nil {
-		e.App.Logger().Error("Failed to find forwarding rule: ", "email", ruleEmail, "err", err)
+	recipients := collectRecipients(payload.Data.To, payload.Data.Cc, payload.Data.Bcc)
+	if len(recipients) == 0 {
+		e.App.Logger().Error("Received email has no recipients: ", "received_email_id", payload.Data.EmailID)
+		return e.JSON(400, map[string]any{"error": "email has no recipients"})
+	}
+
+	// every account only matches its own rules, the email was received by
+	// its Resend account
+	accepted := []ruleMatch{}
+	for userId := range accounts {
+		matches, err := findMatchingRules(e.App, recipients, userId)
+		if err != nil {
+			e.App.Logger().Error("Failed to look up forwarding rules: ", "recipients", recipients, "err", err)
+			return e.JSON(500, map[string]any{"error": "failed to look up forwarding rules"})
+		}
+		accepted = append(accepted, matches...)
+	}
+	if len(accepted) == 0 {
+		e.App.Logger().Error("Failed to find forwarding rule: ", "recipients", recipients)
 		return e.JSON(404, map[string]any{"error": "forwarding rule not found"})
 	}
 
-	userId := rule.GetString("user")
+	email := &inboundEmail{
+		ID:       payload.Data.EmailID,
+		Source:   SourceResend,
+		From:     payload.Data.From,
+		Subject:  payload.Data.Subject,
+		To:       payload.Data.To,
+		Cc:       payload.Data.Cc,
+		Bcc:      payload.Data.Bcc,
+		Accounts: accounts,
+	}
+	if err := queueForwardingEvents(e.App, email, accepted); err != nil {
+		e.App.Logger().Error("Failed to queue forwarding event: ", "err", err)
+		return e.JSON(500, map[string]any{"error": "failed to queue forwarding event"})
+	}
+
+	return e.JSON(200, nil)
+}
+
+func handleEmailSent(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailSentWebhook
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		e.App.Logger().Error("Failed to parse email.sent payload: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
+	}
 
-	forwardingEventId, err := createForwardingEvent(
-		e.App,
-		userId,
-		rule.Id,
-		payload.Data.EmailID,
-		payload.Data.Subject,
-		payload.Data.From,
-		payload.Data.To,
-	)
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Error("Failed to create forwarding event: ", "err", err)
-		return e.JSON(500, map[string]any{"error": "failed to create forwarding event"})
+		e.App.Logger().Debug("No forwarding event found for email.sent: ", "sent_email_id", payload.Data.EmailID)
+		return e.JSON(200, nil)
 	}
 
-	logEvent(e.App, userId, rule.Id, forwardingEventId, EventWebhookReceived, map[string]any{
-		"received_email_id": payload.Data.EmailID,
-		"from":              payload.Data.From,
-		"to":                payload.Data.To,
-		"subject":           payload.Data.Subject,
+	userId := forwardingEvent.GetString("user")
+	ruleId := forwardingEvent.GetString("rule")
+
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailSent, map[string]any{
+		"sent_email_id": payload.Data.EmailID,
+		"to":            payload.Data.To,
+		"subject":       payload.Data.Subject,
+		"delivery":      recordId(delivery),
 	})
 
-	secretRecord, err := e.App.FindFirstRecordByData(collections.ResendWebhookSecrets, "user", userId)
-	if err != nil {
-		e.App.Logger().Error("Failed to find webhook secret for user: ", "user_id", userId, "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message":           "webhook secret not found",
-			"received_email_id": payload.Data.EmailID,
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "webhook_secret_not_found",
-		})
-		return e.JSON(404, map[string]any{"error": "webhook secret not found"})
+	return e.JSON(200, nil)
+}
+
+func handleEmailDelivered(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailDeliveredWebhook
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		e.App.Logger().Error("Failed to parse email.delivered payload: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	encryptedSecret := secretRecord.GetString("secret")
-	secret, err := security.Decrypt(encryptedSecret, os.Getenv("AES_KEY"))
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Error("Failed to decrypt webhook secret: ", "user_id", userId, "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "unable to decrypt webhook secret",
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "webhook_secret_decryption_failed",
-		})
-		return e.JSON(500, map[string]any{"error": "failed to decrypt webhook secret"})
+		e.App.Logger().Debug("No forwarding event found for email.delivered: ", "sent_email_id", payload.Data.EmailID)
+		return e.JSON(200, nil)
 	}
 
-	wh, err := svix.NewWebhook(string(secret))
+	userId := forwardingEvent.GetString("user")
+	ruleId := forwardingEvent.GetString("rule")
+
+	if delivery != nil {
+		err = updateDeliveryStatus(e.App, delivery, StatusDelivered, nil)
+	} else {
+		err = updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusDelivered, "", nil)
+	}
 	if err != nil {
-		e.App.Logger().Error("Failed to create svix webhook: ", "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "unable to create webhook verifier",
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "webhook_verifier_creation_failed",
-		})
-		return e.JSON(500, map[string]any{"error": "failed to create svix webhook"})
+		e.App.Logger().Error("Failed to update forwarding event status to delivered: ", "err", err)
 	}
 
-	if err := wh.Verify(bodyBytes, e.Request.Header); err != nil {
-		e.App.Logger().Error("Invalid webhook signature: ", "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "invalid webhook signature",
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "invalid_webhook_signature",
-		})
-		return e.JSON(401, map[string]any{"error": "invalid webhook signature"})
-	}
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailDelivered, map[string]any{
+		"sent_email_id": payload.Data.EmailID,
+		"to":            payload.Data.To,
+		"subject":       payload.Data.Subject,
+		"delivery":      recordId(delivery),
+	})
 
-	apiKeyRecord, err := e.App.FindFirstRecordByData(collections.ResendAPIKeys, "user", userId)
-	if err != nil {
-		e.App.Logger().Error("Failed to find Resend API key for user: ", "user_id", userId, "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "resend api key not found",
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "api_key_not_found",
-		})
-		return e.JSON(404, map[string]any{"error": "Resend API key not found"})
+	return e.JSON(200, nil)
+}
+
+func handleEmailFailed(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailFailedWebhook
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		e.App.Logger().Error("Failed to parse email.failed payload: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	encryptedKey := apiKeyRecord.GetString("key")
-	apiKey, err := security.Decrypt(encryptedKey, os.Getenv("AES_KEY"))
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Error("Failed to decrypt Resend API key: ", "user_id", userId, "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "unable to decrypt resend api key",
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "api_key_decryption_failed",
-		})
-		return e.JSON(500, map[string]any{"error": "failed to decrypt Resend API key"})
+		e.App.Logger().Debug("No forwarding event found for email.failed: ", "sent_email_id", payload.Data.EmailID)
+		return e.JSON(200, nil)
 	}
 
-	client := resend.NewClient(string(apiKey))
+	userId := forwardingEvent.GetString("user")
+	ruleId := forwardingEvent.GetString("rule")
 
-	email, err := client.Emails.Receiving.Get(payload.Data.EmailID)
+	errorData := map[string]any{
+		"reason": payload.Data.Failed.Reason,
+	}
+	if delivery != nil {
+		err = updateDeliveryStatus(e.App, delivery, StatusFailed, errorData)
+	} else {
+		err = updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusFailed, "", errorData)
+	}
 	if err != nil {
-		e.App.Logger().Error("Failed to get email: ", "received_email_id", payload.Data.EmailID, "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message":           "unable to get email content",
-			"received_email_id": payload.Data.EmailID,
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "email_content_fetch_failed",
-		})
-		return e.JSON(404, map[string]any{"error": "email not found"})
+		e.App.Logger().Error("Failed to update forwarding event status to failed: ", "err", err)
 	}
 
-	emailAttachments := []*resend.Attachment{}
-	if len(email.Attachments) > 0 {
-		attachments, err := client.Emails.Receiving.ListAttachments(payload.Data.EmailID)
-		if err != nil {
-			e.App.Logger().Error("Failed to list attachments: ", "received_email_id", payload.Data.EmailID, "err", err)
-			logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-				"message": "failed to list attachments",
-			})
-		} else {
-			for _, attachment := range attachments.Data {
-				resp, err := http.Get(attachment.DownloadUrl)
-				if err != nil {
-					e.App.Logger().Error("Failed to download attachment", "filename", attachment.Filename, "url", attachment.DownloadUrl, "err", err)
-					continue
-				}
-				defer resp.Body.Close()
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailFailed, map[string]any{
+		"sent_email_id": payload.Data.EmailID,
+		"to":            payload.Data.To,
+		"subject":       payload.Data.Subject,
+		"reason":        payload.Data.Failed.Reason,
+		"delivery":      recordId(delivery),
+	})
 
-				content, err := io.ReadAll(resp.Body)
-				if err != nil {
-					e.App.Logger().Error("Failed to read attachment content", "filename", attachment.Filename, "err", err)
-					continue
-				}
+	return e.JSON(200, nil)
+}
 
-				emailAttachments = append(emailAttachments, &resend.Attachment{
-					ContentType: attachment.ContentType,
-					Filename:    attachment.Filename,
-					Content:     content,
-					ContentId:   attachment.ContentId,
-				})
-			}
-		}
+func handleEmailBounced(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailBouncedWebhook
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		e.App.Logger().Error("Failed to parse email.bounced payload: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	logEvent(e.App, userId, rule.Id, forwardingEventId, EventForwardInitiated, map[string]any{
-		"received_email_id": payload.Data.EmailID,
-		"subject":           payload.Data.Subject,
-	})
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
+	if err != nil {
+		e.App.Logger().Debug("No forwarding event found for email.bounced: ", "sent_email_id", payload.Data.EmailID)
+		return e.JSON(200, nil)
+	}
 
-	forwardToEmail := rule.GetString("forward_to_email")
-	sendFromEmail := rule.GetString("send_from_email")
+	userId := forwardingEvent.GetString("user")
+	ruleId := forwardingEvent.GetString("rule")
 
-	params := &resend.SendEmailRequest{
-		From:        sendFromEmail,
-		To:          []string{forwardToEmail},
-		Subject:     payload.Data.Subject,
-		Html:        email.Html,
-		Text:        email.Text,
-		Attachments: emailAttachments,
-		ReplyTo:     email.From,
-		Bcc:         email.Bcc,
-		Cc:          email.Cc,
+	errorData := map[string]any{
+		"reason":      "bounced",
+		"bounce_type": payload.Data.Bounce.Type,
+		"sub_type":    payload.Data.Bounce.SubType,
+		"message":     payload.Data.Bounce.Message,
+	}
+	if delivery != nil {
+		err = updateDeliveryStatus(e.App, delivery, StatusBounced, errorData)
+	} else {
+		err = updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusBounced, "", errorData)
 	}
-
-	sent, err := client.Emails.Send(params)
 	if err != nil {
-		e.App.Logger().Error("Failed to send email: ", "err", err)
-		logEvent(e.App, userId, rule.Id, forwardingEventId, EventError, map[string]any{
-			"message": "failed to send email",
-			"error":   err.Error(),
-		})
-		updateForwardingEventStatus(e.App, forwardingEventId, StatusFailed, "", map[string]any{
-			"reason": "email_send_failed",
-			"error":  err.Error(),
-		})
-		return e.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send email"})
+		e.App.Logger().Error("Failed to update forwarding event status to bounced: ", "err", err)
 	}
 
-	if err := updateForwardingEventStatus(e.App, forwardingEventId, StatusSent, sent.Id, nil); err != nil {
-		e.App.Logger().Error("Failed to update forwarding event status: ", "err", err)
+	if payload.Data.Bounce.Type == "Permanent" {
+		if err := suppressRecipient(e.App, forwardingEvent, bouncedRecipient(delivery, payload.Data.To), SuppressionReasonHardBounce); err != nil {
+			e.App.Logger().Error("Failed to suppress bounced recipient: ", "sent_email_id", payload.Data.EmailID, "err", err)
+		}
 	}
 
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailBounced, map[string]any{
+		"sent_email_id": payload.Data.EmailID,
+		"to":            payload.Data.To,
+		"subject":       payload.Data.Subject,
+		"bounce_type":   payload.Data.Bounce.Type,
+		"sub_type":      payload.Data.Bounce.SubType,
+		"message":       payload.Data.Bounce.Message,
+		"delivery":      recordId(delivery),
+	})
+
 	return e.JSON(200, nil)
 }
 
-func handleEmailSent(e *core.RequestEvent, bodyBytes []byte) error {
-	var payload EmailSentWebhook
+func handleEmailComplained(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailComplainedWebhook
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
-		e.App.Logger().Error("Failed to parse email.sent payload: ", "err", err)
+		e.App.Logger().Error("Failed to parse email.complained payload: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	forwardingEvent, err := findForwardingEventByResendEmailID(e.App, payload.Data.EmailID)
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Debug("No forwarding event found for email.sent: ", "received_email_id", payload.Data.EmailID)
+		e.App.Logger().Debug("No forwarding event found for email.complained: ", "sent_email_id", payload.Data.EmailID)
 		return e.JSON(200, nil)
 	}
 
 	userId := forwardingEvent.GetString("user")
 	ruleId := forwardingEvent.GetString("rule")
 
-	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailSent, map[string]any{
+	if delivery != nil {
+		err = updateDeliveryStatus(e.App, delivery, StatusComplained, nil)
+	} else {
+		err = updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusComplained, "", nil)
+	}
+	if err != nil {
+		e.App.Logger().Error("Failed to update forwarding event status to complained: ", "err", err)
+	}
+
+	if err := suppressRecipient(e.App, forwardingEvent, bouncedRecipient(delivery, payload.Data.To), SuppressionReasonComplaint); err != nil {
+		e.App.Logger().Error("Failed to suppress complaining recipient: ", "sent_email_id", payload.Data.EmailID, "err", err)
+	}
+
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailComplained, map[string]any{
 		"sent_email_id": payload.Data.EmailID,
 		"to":            payload.Data.To,
 		"subject":       payload.Data.Subject,
+		"delivery":      recordId(delivery),
 	})
 
 	return e.JSON(200, nil)
 }
 
-func handleEmailDelivered(e *core.RequestEvent, bodyBytes []byte) error {
-	var payload EmailDeliveredWebhook
+// handleEmailDeliveryDelayed marks sent emails as delayed. Emails that already
+// reached a final status keep it, since delays can be reported late.
+func handleEmailDeliveryDelayed(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailDeliveryDelayedWebhook
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
-		e.App.Logger().Error("Failed to parse email.delivered payload: ", "err", err)
+		e.App.Logger().Error("Failed to parse email.delivery_delayed payload: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	forwardingEvent, err := findForwardingEventByResendEmailID(e.App, payload.Data.EmailID)
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Debug("No forwarding event found for email.delivered: ", "received_email_id", payload.Data.EmailID)
+		e.App.Logger().Debug("No forwarding event found for email.delivery_delayed: ", "sent_email_id", payload.Data.EmailID)
 		return e.JSON(200, nil)
 	}
 
 	userId := forwardingEvent.GetString("user")
 	ruleId := forwardingEvent.GetString("rule")
 
-	if err := updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusDelivered, "", nil); err != nil {
-		e.App.Logger().Error("Failed to update forwarding event status to delivered: ", "err", err)
+	if delivery != nil {
+		if delivery.GetString("status") == StatusSent {
+			err = updateDeliveryStatus(e.App, delivery, StatusDelayed, nil)
+		}
+	} else if forwardingEvent.GetString("status") == StatusSent {
+		err = updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusDelayed, "", nil)
+	}
+	if err != nil {
+		e.App.Logger().Error("Failed to update forwarding event status to delayed: ", "err", err)
 	}
 
-	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailDelivered, map[string]any{
+	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailDelayed, map[string]any{
 		"sent_email_id": payload.Data.EmailID,
 		"to":            payload.Data.To,
 		"subject":       payload.Data.Subject,
+		"delivery":      recordId(delivery),
 	})
 
 	return e.JSON(200, nil)
 }
 
-func handleEmailFailed(e *core.RequestEvent, bodyBytes []byte) error {
-	var payload EmailFailedWebhook
+func handleEmailOpened(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailOpenedWebhook
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
-		e.App.Logger().Error("Failed to parse email.failed payload: ", "err", err)
+		e.App.Logger().Error("Failed to parse email.opened payload: ", "err", err)
 		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
 
-	forwardingEvent, err := findForwardingEventByResendEmailID(e.App, payload.Data.EmailID)
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
 	if err != nil {
-		e.App.Logger().Debug("No forwarding event found for email.failed: ", "received_email_id", payload.Data.EmailID)
+		e.App.Logger().Debug("No forwarding event found for email.opened: ", "sent_email_id", payload.Data.EmailID)
 		return e.JSON(200, nil)
 	}
 
-	userId := forwardingEvent.GetString("user")
-	ruleId := forwardingEvent.GetString("rule")
+	logEvent(e.App, forwardingEvent.GetString("user"), forwardingEvent.GetString("rule"), forwardingEvent.Id, EventEmailOpened, map[string]any{
+		"sent_email_id": payload.Data.EmailID,
+		"to":            payload.Data.To,
+		"opened_at":     payload.CreatedAt,
+		"delivery":      recordId(delivery),
+	})
 
-	errorData := map[string]any{
-		"reason": payload.Data.Failed.Reason,
+	return e.JSON(200, nil)
+}
+
+func handleEmailClicked(e *core.RequestEvent, accounts verifiedAccounts, bodyBytes []byte) error {
+	var payload EmailClickedWebhook
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		e.App.Logger().Error("Failed to parse email.clicked payload: ", "err", err)
+		return e.JSON(400, map[string]any{"error": "invalid payload"})
 	}
-	if err := updateForwardingEventStatus(e.App, forwardingEvent.Id, StatusFailed, "", errorData); err != nil {
-		e.App.Logger().Error("Failed to update forwarding event status to failed: ", "err", err)
+
+	forwardingEvent, delivery, err := findAccountForwardingEvent(e.App, accounts, payload.Data.EmailID)
+	if err != nil {
+		e.App.Logger().Debug("No forwarding event found for email.clicked: ", "sent_email_id", payload.Data.EmailID)
+		return e.JSON(200, nil)
 	}
 
-	logEvent(e.App, userId, ruleId, forwardingEvent.Id, EventEmailFailed, map[string]any{
+	logEvent(e.App, forwardingEvent.GetString("user"), forwardingEvent.GetString("rule"), forwardingEvent.Id, EventEmailClicked, map[string]any{
 		"sent_email_id": payload.Data.EmailID,
 		"to":            payload.Data.To,
-		"subject":       payload.Data.Subject,
-		"reason":        payload.Data.Failed.Reason,
+		"link":          payload.Data.Click.Link,
+		"clicked_at":    payload.Data.Click.Timestamp,
+		"delivery":      recordId(delivery),
 	})
 
 	return e.JSON(200, nil)
 }
 
-func createForwardingEvent(app core.App, user, rule, receivedEmailID, subject, from string, to []string) (string, error) {
+// inboundEmail is a received email that matched forwarding rules, either
+// announced by a Resend webhook or accepted by the SMTP listener. Raw holds the
+// full MIME message when it is available and Accounts the Resend accounts that
+// verified the webhook.
+type inboundEmail struct {
+	ID       string
+	Source   string
+	From     string
+	Subject  string
+	To       []string
+	Cc       []string
+	Bcc      []string
+	Raw      []byte
+	Accounts verifiedAccounts
+}
+
+// queueForwardingEvents creates a forwarding event for every match of the
+// email and queues what happens next, in a single transaction.
+func queueForwardingEvents(app core.App, email *inboundEmail, matches []ruleMatch) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		for _, match := range matches {
+			userId := match.Rule.GetString("user")
+
+			// disabled rules, and rules forwarding to a suppressed address,
+			// don't forward, their mail is dropped, held or bounced back to
+			// the sender instead
+			// replies to reverse aliases come from the rule's own destinations
+			// and skip the checks meant for outside senders, forwardReply
+			// authenticates them and checks the suppression of their recipient
+			isReply := match.Type == MatchReverseAlias
+
+			disposition, status, jobType := "", StatusPending, jobs.TypeForward
+			suppressed := !isReply && isSuppressed(txApp, userId, match.Rule.GetString("forward_to_email"))
+			if !isReply && (!match.Rule.GetBool("enabled") || suppressed) {
+				disposition, status, jobType = disabledDisposition(match.Rule)
+			}
+
+			// mail of blocked senders is quarantined and never forwarded or
+			// bounced, it is only archived so it can still be released
+			// after Resend's retention window
+			metadata := map[string]any{"match": match.metadata()}
+			var blocked bool
+			var filter *core.Record
+			if !isReply {
+				var err error
+				blocked, filter, err = checkSenderFilters(txApp, match.Rule, email.From)
+				if err != nil {
+					return err
+				}
+			}
+			if blocked {
+				disposition, status, jobType = "", StatusBlocked, ""
+				if email.Raw == nil {
+					jobType = jobs.TypeArchive
+				}
+				metadata["sender_filter"] = senderFilterMetadata(filter)
+			}
+
+			forwardingEventId, err := createForwardingEvent(txApp, userId, match, email, status, metadata)
+			if err != nil {
+				return err
+			}
+
+			logEvent(txApp, userId, match.Rule.Id, forwardingEventId, EventWebhookReceived, map[string]any{
+				"received_email_id": email.ID,
+				"source":            email.Source,
+				"from":              email.From,
+				"to":                email.To,
+				"cc":                email.Cc,
+				"bcc":               email.Bcc,
+				"match":             match.metadata(),
+				"subject":           email.Subject,
+			})
+
+			if blocked {
+				logEvent(txApp, userId, match.Rule.Id, forwardingEventId, EventSenderBlocked, map[string]any{
+					"from":          email.From,
+					"sender_filter": metadata["sender_filter"],
+				})
+
+				if err := quarantineMessage(txApp, userId, match.Rule.Id, forwardingEventId, QuarantineReasonSenderBlocked, map[string]any{
+					"from":          email.From,
+					"sender_filter": metadata["sender_filter"],
+				}); err != nil {
+					return err
+				}
+			}
+
+			if disposition != "" {
+				logEvent(txApp, userId, match.Rule.Id, forwardingEventId, EventRuleDisabled, map[string]any{
+					"disposition": disposition,
+					"suppressed":  suppressed,
+				})
+			}
+
+			if jobType == "" {
+				continue
+			}
+			if _, err := jobs.Enqueue(txApp, jobType, userId, forwardingEventId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func createForwardingEvent(app core.App, user string, match ruleMatch, email *inboundEmail, status string, metadata map[string]any) (string, error) {
 	collection, err := app.FindCollectionByNameOrId(collections.ForwardingEvents)
 	if err != nil {
 		return "", err
@@ -369,12 +669,25 @@ func createForwardingEvent(app core.App, user, rule, receivedEmailID, subject, f
 
 	event := core.NewRecord(collection)
 	event.Set("user", user)
-	event.Set("rule", rule)
-	event.Set("received_email_id", receivedEmailID)
-	event.Set("status", StatusPending)
-	event.Set("subject", subject)
-	event.Set("from", from)
-	event.Set("to", to[0])
+	event.Set("rule", match.Rule.Id)
+	event.Set("received_email_id", email.ID)
+	event.Set("source", email.Source)
+	event.Set("status", status)
+	event.Set("subject", email.Subject)
+	event.Set("from", email.From)
+	event.Set("to", match.Recipient)
+	event.Set("metadata", metadata)
+	if account := email.Accounts[user]; account != nil {
+		event.Set("webhook_secret", account.Id)
+	}
+
+	if email.Raw != nil {
+		raw, err := filesystem.NewFileFromBytes(email.Raw, "message.eml")
+		if err != nil {
+			return "", err
+		}
+		event.Set("raw_message", raw)
+	}
 
 	if err := app.Save(event); err != nil {
 		return "", err
@@ -400,8 +713,24 @@ func updateForwardingEventStatus(app core.App, eventId, status, resendEmailID st
 	return app.Save(event)
 }
 
-func findForwardingEventByResendEmailID(app core.App, resendEmailID string) (*core.Record, error) {
-	return app.FindFirstRecordByData(collections.ForwardingEvents, "sent_email_id", resendEmailID)
+// findForwardingEventBySentEmailID resolves the forwarding event of an
+// outbound email, together with its per-recipient delivery. The delivery is
+// nil for events created before deliveries were tracked.
+func findForwardingEventBySentEmailID(app core.App, sentEmailID string) (*core.Record, *core.Record, error) {
+	if delivery, err := findDeliveryBySentEmailID(app, sentEmailID); err == nil {
+		event, err := app.FindRecordById(collections.ForwardingEvents, delivery.GetString("event"))
+		return event, delivery, err
+	}
+
+	event, err := app.FindFirstRecordByData(collections.ForwardingEvents, "sent_email_id", sentEmailID)
+	return event, nil, err
+}
+
+func recordId(record *core.Record) string {
+	if record == nil {
+		return ""
+	}
+	return record.Id
 }
 
 func logEvent(app core.App, user, rule, forwardingEvent, eventType string, metadata map[string]any) {
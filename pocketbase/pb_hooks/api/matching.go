@@ -0,0 +1,281 @@
+package api
+
+import (
+	"net/mail"
+	"slices"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	MatchExact       = "exact"
+	MatchPlusAddress = "plus_address"
+	MatchWildcard    = "wildcard"
+	MatchCatchAll    = "catch_all"
+)
+
+// ruleMatch is a forwarding rule together with the recipient address it
+// matched and how it was matched.
+type ruleMatch struct {
+	Rule      *core.Record
+	Recipient string
+	Type      string
+	Tag       string
+}
+
+func (m ruleMatch) metadata() map[string]any {
+	data := map[string]any{
+		"type":      m.Type,
+		"pattern":   m.Rule.GetString("rule_email"),
+		"recipient": m.Recipient,
+	}
+	if m.Tag != "" {
+		data["tag"] = m.Tag
+	}
+	return data
+}
+
+// collectRecipients returns the normalized, de-duplicated addresses from all
+// recipient lists of a received email.
+func collectRecipients(lists ...[]string) []string {
+	seen := map[string]bool{}
+	recipients := []string{}
+
+	for _, list := range lists {
+		for _, raw := range list {
+			address := normalizeAddress(raw)
+			if address == "" || seen[address] {
+				continue
+			}
+			seen[address] = true
+			recipients = append(recipients, address)
+		}
+	}
+
+	return recipients
+}
+
+func normalizeAddress(raw string) string {
+	if parsed, err := mail.ParseAddress(raw); err == nil {
+		return strings.ToLower(parsed.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(raw))
+}
+
+func splitAddress(address string) (string, string) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address, ""
+	}
+	return address[:at], address[at+1:]
+}
+
+// findMatchingRules resolves the forwarding rule of every recipient. A rule
+// matched by several recipients is only returned once. When userId is set
+// only that user's rules are considered, which is how mail received by a
+// user's Resend account is matched.
+func findMatchingRules(app core.App, recipients []string, userId string) ([]ruleMatch, error) {
+	matches := []ruleMatch{}
+	seen := map[string]bool{}
+
+	for _, recipient := range recipients {
+		match, err := findRuleForRecipient(app, recipient, userId)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil || seen[match.Rule.Id] {
+			continue
+		}
+
+		seen[match.Rule.Id] = true
+		matches = append(matches, *match)
+	}
+
+	return matches, nil
+}
+
+// findRuleForRecipient returns the best rule for a single recipient, checking
+// in order: a reverse alias of a reply-through rule, an exact rule_email match, the plus-address base (user+tag@ ->
+// user@), the most specific wildcard pattern (*@support.example.com,
+// sales-*@example.com) and finally the catch-all rule of the domain.
+//
+// Wildcard and catch-all rules can be created for any domain, so without a
+// userId they only match when all of them belong to the same user. Otherwise
+// one user could capture or block another user's mail.
+func findRuleForRecipient(app core.App, recipient, userId string) (*ruleMatch, error) {
+	local, domain := splitAddress(recipient)
+	if domain == "" {
+		return nil, nil
+	}
+
+	alias, err := findReverseAlias(app, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if alias != nil {
+		rule, err := app.FindRecordById(collections.ForwardingRules, alias.GetString("rule"))
+		if err != nil {
+			return nil, err
+		}
+		if userId == "" || rule.GetString("user") == userId {
+			return &ruleMatch{Rule: rule, Recipient: recipient, Type: MatchReverseAlias}, nil
+		}
+	}
+
+	tag := ""
+	base := local
+	if i := strings.Index(local, "+"); i > 0 {
+		base, tag = local[:i], local[i+1:]
+	}
+
+	rule, err := findRuleByEmail(app, recipient, userId)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		return &ruleMatch{Rule: rule, Recipient: recipient, Type: MatchExact, Tag: tag}, nil
+	}
+
+	if tag != "" {
+		rule, err := findRuleByEmail(app, base+"@"+domain, userId)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			return &ruleMatch{Rule: rule, Recipient: recipient, Type: MatchPlusAddress, Tag: tag}, nil
+		}
+	}
+
+	patterns, err := findRulesByDomain(app, domain, userId, dbx.Or(
+		dbx.NewExp("[[rule_email]] LIKE '%*%'"),
+		dbx.HashExp{"catch_all": true},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if userId == "" && !sameOwner(patterns) {
+		app.Logger().Warn("Ignoring wildcard and catch-all rules of several users: ", "domain", domain)
+		return nil, nil
+	}
+
+	var best *core.Record
+	bestSpecificity := -1
+	for _, candidate := range patterns {
+		pattern, _ := splitAddress(strings.ToLower(candidate.GetString("rule_email")))
+		if !strings.Contains(pattern, "*") {
+			continue
+		}
+		if !rules.MatchWildcard(pattern, local) && (tag == "" || !rules.MatchWildcard(pattern, base)) {
+			continue
+		}
+
+		// the pattern with the most literal characters is the most specific
+		specificity := len(strings.ReplaceAll(pattern, "*", ""))
+		if specificity > bestSpecificity {
+			best, bestSpecificity = candidate, specificity
+		}
+	}
+	if best != nil {
+		return &ruleMatch{Rule: best, Recipient: recipient, Type: MatchWildcard, Tag: tag}, nil
+	}
+
+	for _, candidate := range patterns {
+		if candidate.GetBool("catch_all") {
+			return &ruleMatch{Rule: candidate, Recipient: recipient, Type: MatchCatchAll, Tag: tag}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// findRuleOwners returns the users with a rule that may match one of the
+// recipients, i.e. with a rule on a recipient's domain or a reverse alias.
+func findRuleOwners(app core.App, recipients []string) ([]string, error) {
+	users := []string{}
+	add := func(userId string) {
+		if !slices.Contains(users, userId) {
+			users = append(users, userId)
+		}
+	}
+
+	for _, recipient := range recipients {
+		_, domain := splitAddress(recipient)
+		if domain == "" {
+			continue
+		}
+
+		alias, err := findReverseAlias(app, recipient)
+		if err != nil {
+			return nil, err
+		}
+		if alias != nil {
+			if rule, err := app.FindRecordById(collections.ForwardingRules, alias.GetString("rule")); err == nil {
+				add(rule.GetString("user"))
+			}
+		}
+
+		domainRules, err := findRulesByDomain(app, domain, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range domainRules {
+			add(rule.GetString("user"))
+		}
+	}
+
+	return users, nil
+}
+
+func sameOwner(records []*core.Record) bool {
+	for _, record := range records {
+		if record.GetString("user") != records[0].GetString("user") {
+			return false
+		}
+	}
+	return true
+}
+
+func findRuleByEmail(app core.App, email, userId string) (*core.Record, error) {
+	exprs := []dbx.Expression{dbx.NewExp("LOWER([[rule_email]]) = {:email}", dbx.Params{
+		"email": email,
+	})}
+	if userId != "" {
+		exprs = append(exprs, dbx.HashExp{"user": userId})
+	}
+
+	records, err := app.FindAllRecords(collections.ForwardingRules, exprs...)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// findRulesByDomain returns the rules of a domain matching exp, oldest first,
+// limited to the user's rules when userId is set.
+func findRulesByDomain(app core.App, domain, userId string, exp dbx.Expression) ([]*core.Record, error) {
+	records := []*core.Record{}
+	query := app.RecordQuery(collections.ForwardingRules).
+		AndWhere(dbx.NewExp("LOWER([[rule_email]]) LIKE {:domain}", dbx.Params{"domain": "%@" + domain})).
+		AndWhere(exp).
+		OrderBy("created ASC")
+	if userId != "" {
+		query.AndWhere(dbx.HashExp{"user": userId})
+	}
+	if err := query.All(&records); err != nil {
+		return nil, err
+	}
+
+	// LIKE treats "_" in the domain as a wildcard, so compare exactly
+	rules := []*core.Record{}
+	for _, rule := range records {
+		if _, ruleDomain := splitAddress(strings.ToLower(rule.GetString("rule_email"))); ruleDomain == domain {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/resend/resend-go/v3"
+)
+
+// buildMIMEMessage renders an outbound email as a MIME message.
+func buildMIMEMessage(email *OutboundEmail, messageId string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", email.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	if email.ReplyTo != "" {
+		fmt.Fprintf(&buf, "Reply-To: %s\r\n", email.ReplyTo)
+	}
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", messageId)
+
+	if err := writeMIMEBody(&buf, email.Text, email.Html, email.Attachments); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildRawMessage reconstructs the raw message of an email received through
+// Resend, which doesn't expose the original MIME source. The original headers
+// are kept, the body is rebuilt from the text, html and attachments.
+func buildRawMessage(content *messageContent) ([]byte, error) {
+	var buf bytes.Buffer
+
+	names := make([]string, 0, len(content.Headers))
+	for name := range content.Headers {
+		switch strings.ToLower(name) {
+		case "content-type", "content-transfer-encoding", "mime-version":
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		fmt.Fprintf(&buf, "From: %s\r\n", content.From)
+		fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", content.Subject))
+	}
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", textproto.CanonicalMIMEHeaderKey(name), content.Headers[name])
+	}
+
+	if err := writeMIMEBody(&buf, content.Text, content.Html, content.Attachments); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeMIMEBody writes the MIME-Version and Content-Type headers followed by a
+// multipart/mixed body with the text and html bodies as alternatives and the
+// attachments after them.
+func writeMIMEBody(buf *bytes.Buffer, text, html string, attachments []*resend.Attachment) error {
+	mixed := multipart.NewWriter(buf)
+	alternativeBoundary := multipart.NewWriter(io.Discard).Boundary()
+
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	bodyPart, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternativeBoundary},
+	})
+	if err != nil {
+		return err
+	}
+
+	alternative := multipart.NewWriter(bodyPart)
+	if err := alternative.SetBoundary(alternativeBoundary); err != nil {
+		return err
+	}
+
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain", text},
+		{"text/html", html},
+	} {
+		if body.content == "" {
+			continue
+		}
+
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(body.content)); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		}
+		if attachment.ContentId != "" {
+			header.Set("Content-ID", "<"+attachment.ContentId+">")
+			header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+		}
+
+		part, err := mixed.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	return mixed.Close()
+}
+
+// parseRawMessage extracts the bodies, headers and attachments of a raw MIME
+// message. The first text/plain and text/html parts become the bodies, every
+// other leaf part is treated as an attachment.
+func parseRawMessage(raw []byte) (*messageContent, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := &mime.WordDecoder{}
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	content := &messageContent{
+		From:         msg.Header.Get("From"),
+		Subject:      subject,
+		Headers:      map[string]string{},
+		HeaderValues: map[string][]string{},
+		Attachments:  []*resend.Attachment{},
+	}
+	for name, values := range msg.Header {
+		content.Headers[strings.ToLower(name)] = strings.Join(values, ", ")
+		content.HeaderValues[strings.ToLower(name)] = values
+	}
+
+	err = parseMIMEPart(content, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", "", msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+func parseMIMEPart(content *messageContent, contentType, encoding, disposition, contentId string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			err = parseMIMEPart(
+				content,
+				part.Header.Get("Content-Type"),
+				part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"),
+				strings.Trim(part.Header.Get("Content-ID"), "<>"),
+				part,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// multipart.Reader decodes quoted-printable parts itself and drops their
+	// Content-Transfer-Encoding header
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	isAttachment := dispositionType == "attachment" || dispositionParams["filename"] != ""
+
+	switch {
+	case mediaType == "text/plain" && !isAttachment && content.Text == "":
+		content.Text = string(data)
+	case mediaType == "text/html" && !isAttachment && content.Html == "":
+		content.Html = string(data)
+	default:
+		filename := dispositionParams["filename"]
+		if filename == "" {
+			filename = params["name"]
+		}
+		content.Attachments = append(content.Attachments, &resend.Attachment{
+			ContentType: mediaType,
+			Filename:    filename,
+			Content:     data,
+			ContentId:   contentId,
+		})
+	}
+
+	return nil
+}
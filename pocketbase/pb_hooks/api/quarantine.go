@@ -0,0 +1,166 @@
+package api
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	QuarantineReasonAuthFailed    = "auth_failed"
+	QuarantineReasonSenderBlocked = "sender_blocked"
+
+	defaultQuarantineRetentionDays = 14
+)
+
+// quarantineMessage puts the event's message in quarantine until it is
+// released, deleted or expires after QUARANTINE_RETENTION_DAYS.
+func quarantineMessage(app core.App, userId, ruleId, eventId, reason string, details map[string]any) error {
+	collection, err := app.FindCollectionByNameOrId(collections.Quarantine)
+	if err != nil {
+		return err
+	}
+
+	retentionDays := defaultQuarantineRetentionDays
+	if n, err := strconv.Atoi(os.Getenv("QUARANTINE_RETENTION_DAYS")); err == nil && n > 0 {
+		retentionDays = n
+	}
+
+	expiresAt, err := types.ParseDateTime(time.Now().AddDate(0, 0, retentionDays).UTC())
+	if err != nil {
+		return err
+	}
+
+	item := core.NewRecord(collection)
+	item.Set("user", userId)
+	item.Set("rule", ruleId)
+	item.Set("forwarding_event", eventId)
+	item.Set("reason", reason)
+	item.Set("details", details)
+	item.Set("expires_at", expiresAt)
+	if err := app.Save(item); err != nil {
+		return err
+	}
+
+	logEvent(app, userId, ruleId, eventId, EventMessageQuarantined, map[string]any{
+		"quarantine": item.Id,
+		"reason":     reason,
+		"expires_at": expiresAt.String(),
+	})
+
+	return nil
+}
+
+// releasedFromQuarantine reports whether the event's message was released
+// from quarantine, so the checks that quarantined it don't run again.
+func releasedFromQuarantine(event *core.Record) bool {
+	metadata := map[string]any{}
+	if err := event.UnmarshalJSONField("metadata", &metadata); err != nil {
+		return false
+	}
+
+	released, _ := metadata["quarantine_released"].(bool)
+	return released
+}
+
+// DeleteQuarantinedMessage removes a quarantined message for good: the raw
+// message is deleted, the event is marked dropped and the quarantine item
+// is removed.
+func DeleteQuarantinedMessage(app core.App, item *core.Record, reason string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		event, err := txApp.FindRecordById(collections.ForwardingEvents, item.GetString("forwarding_event"))
+		if err == nil {
+			event.Set("status", StatusDropped)
+			event.Set("raw_message", "")
+			if err := txApp.Save(event); err != nil {
+				return err
+			}
+
+			logEvent(txApp, event.GetString("user"), event.GetString("rule"), event.Id, EventQuarantineDeleted, map[string]any{
+				"quarantine": item.Id,
+				"reason":     reason,
+			})
+		}
+
+		return txApp.Delete(item)
+	})
+}
+
+func findQuarantineItem(e *core.RequestEvent) (*core.Record, error) {
+	item, err := e.App.FindRecordById(collections.Quarantine, e.Request.PathValue("id"))
+	if err != nil || item.GetString("user") != e.Auth.Id {
+		return nil, e.NotFoundError("quarantined message not found", nil)
+	}
+
+	return item, nil
+}
+
+// releaseQuarantineHandler forwards a quarantined message as if it had passed
+// the checks that stopped it.
+func releaseQuarantineHandler(e *core.RequestEvent) error {
+	item, err := findQuarantineItem(e)
+	if err != nil {
+		return err
+	}
+
+	event, err := e.App.FindRecordById(collections.ForwardingEvents, item.GetString("forwarding_event"))
+	if err != nil {
+		return e.NotFoundError("forwarding event not found", nil)
+	}
+
+	if _, err := e.App.FindRecordById(collections.ForwardingRules, event.GetString("rule")); err != nil {
+		return e.BadRequestError("the forwarding rule for this event no longer exists", nil)
+	}
+
+	metadata := map[string]any{}
+	if err := event.UnmarshalJSONField("metadata", &metadata); err != nil {
+		metadata = map[string]any{}
+	}
+	metadata["quarantine_released"] = true
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		event.Set("status", StatusPending)
+		event.Set("metadata", metadata)
+		if err := txApp.Save(event); err != nil {
+			return err
+		}
+
+		logEvent(txApp, event.GetString("user"), event.GetString("rule"), event.Id, EventForwardReleased, map[string]any{
+			"received_email_id": event.GetString("received_email_id"),
+			"quarantine":        item.Id,
+			"reason":            item.GetString("reason"),
+		})
+
+		if err := txApp.Delete(item); err != nil {
+			return err
+		}
+
+		_, err := jobs.Enqueue(txApp, jobs.TypeForward, event.GetString("user"), event.Id)
+		return err
+	})
+	if err != nil {
+		e.App.Logger().Error("Failed to release quarantined message: ", "quarantine_id", item.Id, "err", err)
+		return e.InternalServerError("failed to release quarantined message", nil)
+	}
+
+	return e.JSON(200, map[string]any{"id": event.Id})
+}
+
+func deleteQuarantineHandler(e *core.RequestEvent) error {
+	item, err := findQuarantineItem(e)
+	if err != nil {
+		return err
+	}
+
+	if err := DeleteQuarantinedMessage(e.App, item, "deleted"); err != nil {
+		e.App.Logger().Error("Failed to delete quarantined message: ", "quarantine_id", item.Id, "err", err)
+		return e.InternalServerError("failed to delete quarantined message", nil)
+	}
+
+	return e.NoContent(204)
+}
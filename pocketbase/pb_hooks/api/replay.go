@@ -0,0 +1,94 @@
+package api
+
+import (
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// replayForwardingEventHandler queues a new forwarding event for the same
+// received email as an existing event, using the rule's current settings.
+func replayForwardingEventHandler(e *core.RequestEvent) error {
+	original, err := e.App.FindRecordById(collections.ForwardingEvents, e.Request.PathValue("id"))
+	if err != nil || original.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("forwarding event not found", nil)
+	}
+
+	// a replay is forwarded like new mail would be, so mail that was never
+	// meant to go out has to take the way that keeps the checks in place
+	switch original.GetString("status") {
+	case StatusHeld:
+		return e.BadRequestError("held forwarding events can't be replayed, release them with POST /api/forwarding-events/{id}/release instead", nil)
+	case StatusBlocked, StatusQuarantined:
+		return e.BadRequestError("quarantined forwarding events can't be replayed, release them with POST /api/quarantine/{id}/release instead", nil)
+	case StatusDropped, StatusReturned:
+		return e.BadRequestError("forwarding events that were not forwarded can't be replayed", nil)
+	}
+
+	if _, err := e.App.FindRecordById(collections.ForwardingRules, original.GetString("rule")); err != nil {
+		return e.BadRequestError("the forwarding rule for this event no longer exists", nil)
+	}
+
+	var replayId string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		replay, err := replayForwardingEvent(txApp, original)
+		if err != nil {
+			return err
+		}
+		replayId = replay.Id
+
+		logEvent(txApp, replay.GetString("user"), replay.GetString("rule"), replay.Id, EventForwardReplayed, map[string]any{
+			"received_email_id": replay.GetString("received_email_id"),
+			"replay_of":         original.Id,
+		})
+
+		_, err = jobs.Enqueue(txApp, jobs.TypeForward, replay.GetString("user"), replay.Id)
+		return err
+	})
+	if err != nil {
+		e.App.Logger().Error("Failed to replay forwarding event: ", "event_id", original.Id, "err", err)
+		return e.InternalServerError("failed to replay forwarding event", nil)
+	}
+
+	return e.JSON(200, map[string]any{"id": replayId})
+}
+
+func replayForwardingEvent(app core.App, original *core.Record) (*core.Record, error) {
+	replay := core.NewRecord(original.Collection())
+	replay.Set("user", original.GetString("user"))
+	replay.Set("rule", original.GetString("rule"))
+	replay.Set("received_email_id", original.GetString("received_email_id"))
+	replay.Set("status", StatusPending)
+	replay.Set("subject", original.GetString("subject"))
+	replay.Set("from", original.GetString("from"))
+	replay.Set("to", original.GetString("to"))
+	// a release from the quarantine only covers the released event
+	metadata := map[string]any{}
+	if err := original.UnmarshalJSONField("metadata", &metadata); err == nil {
+		delete(metadata, "quarantine_released")
+	}
+	replay.Set("metadata", metadata)
+	replay.Set("source", original.GetString("source"))
+	replay.Set("webhook_secret", original.GetString("webhook_secret"))
+	replay.Set("replay_of", original.Id)
+
+	if original.GetString("raw_message") != "" {
+		raw, err := readRawMessage(app, original)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := filesystem.NewFileFromBytes(raw, "message.eml")
+		if err != nil {
+			return nil, err
+		}
+		replay.Set("raw_message", file)
+	}
+
+	if err := app.Save(replay); err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
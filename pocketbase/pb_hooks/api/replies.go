@@ -0,0 +1,187 @@
+package api
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const (
+	MatchReverseAlias = "reverse_alias"
+
+	reverseAliasAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// reverseAliasReplyTo returns the Reply-To of a forward for reply-through
+// rules: the sender's reverse alias on the rule's domain, created on first
+// use, so replies come back through the forwarder instead of going out from
+// the destination's own address.
+func reverseAliasReplyTo(app core.App, rule *core.Record, from string) (string, error) {
+	name, sender := "", normalizeAddress(from)
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		name = parsed.Name
+	}
+
+	alias, err := app.FindFirstRecordByFilter(collections.ReverseAliases, "rule = {:rule} && sender = {:sender}", dbx.Params{
+		"rule":   rule.Id,
+		"sender": sender,
+	})
+	if err != nil {
+		collection, err := app.FindCollectionByNameOrId(collections.ReverseAliases)
+		if err != nil {
+			return "", err
+		}
+
+		_, domain := splitAddress(strings.ToLower(rule.GetString("rule_email")))
+
+		alias = core.NewRecord(collection)
+		alias.Set("user", rule.GetString("user"))
+		alias.Set("rule", rule.Id)
+		alias.Set("sender", sender)
+		alias.Set("sender_name", name)
+		alias.Set("alias", "reply-"+security.RandomStringWithAlphabet(20, reverseAliasAlphabet)+"@"+domain)
+		if err := app.Save(alias); err != nil {
+			return "", err
+		}
+	}
+
+	address := mail.Address{Name: alias.GetString("sender_name"), Address: alias.GetString("alias")}
+	return address.String(), nil
+}
+
+// findReverseAlias returns the reverse alias with the given address, nil when
+// there is none.
+func findReverseAlias(app core.App, address string) (*core.Record, error) {
+	records, err := app.FindAllRecords(collections.ReverseAliases, dbx.HashExp{"alias": address})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// isReplyEvent reports whether the event is a reply sent to a reverse alias.
+func isReplyEvent(event *core.Record) bool {
+	metadata := struct {
+		Match struct {
+			Type string `json:"type"`
+		} `json:"match"`
+	}{}
+	if err := event.UnmarshalJSONField("metadata", &metadata); err != nil {
+		return false
+	}
+
+	return metadata.Match.Type == MatchReverseAlias
+}
+
+// forwardReply sends a reply that arrived at a reverse alias on to the
+// original sender, from the rule's send_from_email. Only the rule's own
+// destinations may reply, and since the From header is easily forged the
+// reply must also pass DMARC, or DKIM for the sender's domain, as reported by
+// a trusted receiver. Anyone else writing to the alias is rejected, as is mail
+// received by the SMTP listener, which verifies nothing. Suppressed original
+// senders aren't written to.
+func forwardReply(app core.App, event, rule *core.Record, content *messageContent, attempt int) error {
+	userId := event.GetString("user")
+
+	alias, err := findReverseAlias(app, event.GetString("to"))
+	if err != nil || alias == nil {
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "reverse_alias_not_found",
+		})
+		return err
+	}
+
+	from := normalizeAddress(content.From)
+	allowed, err := isRuleDestination(app, rule, from)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		logEvent(app, userId, rule.Id, event.Id, EventReplyRejected, map[string]any{
+			"from":  from,
+			"alias": alias.GetString("alias"),
+		})
+		updateForwardingEventStatus(app, event.Id, StatusBlocked, "", map[string]any{
+			"reason": "reply_sender_not_allowed",
+		})
+		return nil
+	}
+
+	if results := saveAuthResults(app, event, content); !results.authenticates(from) {
+		logEvent(app, userId, rule.Id, event.Id, EventReplyRejected, map[string]any{
+			"from":           from,
+			"alias":          alias.GetString("alias"),
+			"authentication": results,
+		})
+		updateForwardingEventStatus(app, event.Id, StatusBlocked, "", map[string]any{
+			"reason": "reply_sender_not_authenticated",
+		})
+		return nil
+	}
+
+	if isSuppressed(app, userId, alias.GetString("sender")) {
+		updateForwardingEventStatus(app, event.Id, StatusDropped, "", map[string]any{
+			"reason": "recipient_suppressed",
+		})
+		return nil
+	}
+
+	sender, err := senderForEvent(app, event, rule)
+	if err != nil {
+		return err
+	}
+
+	sentEmailId, err := sender.Send(&OutboundEmail{
+		From:        rule.GetString("send_from_email"),
+		To:          alias.GetString("sender"),
+		Subject:     content.Subject,
+		Html:        content.Html,
+		Text:        content.Text,
+		Attachments: content.Attachments,
+	})
+	if err != nil {
+		app.Logger().Error("Failed to send reply: ", "event_id", event.Id, "err", err)
+		logEvent(app, userId, rule.Id, event.Id, EventError, map[string]any{
+			"message": "failed to send reply",
+			"error":   err.Error(),
+			"attempt": attempt,
+		})
+		if isTransientError(err) && scheduleRetry(app, event, "reply_send_failed", err) {
+			return err
+		}
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "reply_send_failed",
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	logEvent(app, userId, rule.Id, event.Id, EventReplySent, map[string]any{
+		"sent_email_id": sentEmailId,
+		"alias":         alias.GetString("alias"),
+		"attempt":       attempt,
+	})
+
+	return updateForwardingEventStatus(app, event.Id, StatusSent, sentEmailId, nil)
+}
+
+// isRuleDestination reports whether the address is the rule's forward_to_email
+// or one of its email destinations.
+func isRuleDestination(app core.App, rule *core.Record, address string) (bool, error) {
+	destinations, err := resolveDestinations(app, rule)
+	if err != nil {
+		return false, err
+	}
+
+	for _, destination := range destinations {
+		if destination.Type == DestinationTypeEmail && destination.Recipient == address {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/netguard"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/resend/resend-go/v3"
+)
+
+const (
+	defaultMaxAttempts = 5
+	baseRetryDelay     = time.Minute
+	maxRetryDelay      = 6 * time.Hour
+)
+
+// serverError is returned by the Resend transport for 5xx responses so that
+// they can be told apart from permanent client errors.
+type serverError struct {
+	StatusCode int
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("resend responded with status %d", e.StatusCode)
+}
+
+type retryableTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 500 {
+		resp.Body.Close()
+		return nil, &serverError{StatusCode: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+func newResendClient(apiKey string) *resend.Client {
+	return resend.NewCustomClient(&http.Client{
+		Timeout:   60 * time.Second,
+		Transport: &retryableTransport{base: http.DefaultTransport},
+	}, apiKey)
+}
+
+// isTransientError reports whether err is worth retrying: network failures,
+// rate limits, 5xx and 429 responses and 4xx SMTP replies.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, resend.ErrRateLimit) {
+		return true
+	}
+
+	// a forbidden address won't become reachable by trying again
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return false
+	}
+
+	var srvErr *serverError
+	if errors.As(err, &srvErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func maxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("FORWARD_MAX_ATTEMPTS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxAttempts
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// scheduleRetry moves the event to the retrying status so the RetryForwards
+// cron picks it up again. It returns false once the attempt limit is reached.
+func scheduleRetry(app core.App, event *core.Record, reason string, cause error) bool {
+	attempt := event.GetInt("attempts")
+	if attempt >= maxAttempts() {
+		return false
+	}
+
+	nextAttempt := types.NowDateTime().Add(retryDelay(attempt))
+
+	event.Set("status", StatusRetrying)
+	event.Set("next_attempt_at", nextAttempt)
+	event.Set("error", map[string]any{
+		"reason": reason,
+		"error":  cause.Error(),
+	})
+	if err := app.Save(event); err != nil {
+		app.Logger().Error("Failed to schedule forwarding retry: ", "event_id", event.Id, "err", err)
+		return false
+	}
+
+	logEvent(app, event.GetString("user"), event.GetString("rule"), event.Id, EventForwardRetrying, map[string]any{
+		"attempt":         attempt,
+		"max_attempts":    maxAttempts(),
+		"reason":          reason,
+		"error":           cause.Error(),
+		"next_attempt_at": nextAttempt.String(),
+	})
+
+	return true
+}
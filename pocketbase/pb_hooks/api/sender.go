@@ -0,0 +1,127 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/providers"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/resend/resend-go/v3"
+)
+
+// Sender delivers a single outbound email and returns the provider's id for
+// it. Errors are classified with isTransientError like any other send error.
+type Sender interface {
+	Send(email *OutboundEmail) (string, error)
+}
+
+// OutboundEmail is a provider independent outbound message with a single
+// recipient.
+type OutboundEmail struct {
+	From        string
+	To          string
+	ReplyTo     string
+	Subject     string
+	Html        string
+	Text        string
+	Attachments []*resend.Attachment
+}
+
+type resendSender struct {
+	client *resend.Client
+}
+
+func (s *resendSender) Send(email *OutboundEmail) (string, error) {
+	params := &resend.SendEmailRequest{
+		From:        email.From,
+		To:          []string{email.To},
+		Subject:     email.Subject,
+		Html:        email.Html,
+		Text:        email.Text,
+		Attachments: email.Attachments,
+	}
+	if email.ReplyTo != "" {
+		params.ReplyTo = email.ReplyTo
+	}
+
+	sent, err := s.client.Emails.Send(params)
+	if err != nil {
+		return "", err
+	}
+	return sent.Id, nil
+}
+
+// senderForEvent returns the sender for outbound mail of the event's rule:
+// the rule's own delivery provider, else the account's default provider, else
+// the account's Resend API key. Failures are logged and fail the event.
+func senderForEvent(app core.App, event, rule *core.Record) (Sender, error) {
+	provider, err := findDeliveryProvider(app, rule)
+	if err == nil && provider == nil {
+		client, err := resendClientForEvent(app, event)
+		if err != nil {
+			return nil, err
+		}
+		return &resendSender{client: client}, nil
+	}
+
+	var sender Sender
+	if err == nil {
+		sender, err = newSender(provider)
+	}
+	if err != nil {
+		app.Logger().Error("Failed to set up delivery provider: ", "rule_id", rule.Id, "err", err)
+		logEvent(app, event.GetString("user"), rule.Id, event.Id, EventError, map[string]any{
+			"message": "unable to set up delivery provider",
+		})
+		updateForwardingEventStatus(app, event.Id, StatusFailed, "", map[string]any{
+			"reason": "delivery_provider_unavailable",
+		})
+		return nil, err
+	}
+
+	return sender, nil
+}
+
+func findDeliveryProvider(app core.App, rule *core.Record) (*core.Record, error) {
+	if providerId := rule.GetString("provider"); providerId != "" {
+		return app.FindRecordById(collections.DeliveryProviders, providerId)
+	}
+
+	defaults, err := app.FindRecordsByFilter(
+		collections.DeliveryProviders,
+		"user = {:user} && is_default = true",
+		"-updated",
+		1,
+		0,
+		dbx.Params{"user": rule.GetString("user")},
+	)
+	if err != nil || len(defaults) == 0 {
+		return nil, err
+	}
+
+	return defaults[0], nil
+}
+
+func newSender(provider *core.Record) (Sender, error) {
+	secret := ""
+	if encryptedSecret := provider.GetString("secret"); encryptedSecret != "" {
+		decrypted, err := secrets.Decrypt(encryptedSecret)
+		if err != nil {
+			return nil, err
+		}
+		secret = decrypted
+	}
+
+	if provider.GetString("type") == providers.TypeSMTP {
+		return &smtpSender{
+			host:     provider.GetString("host"),
+			port:     strconv.Itoa(provider.GetInt("port")),
+			username: provider.GetString("username"),
+			password: secret,
+		}, nil
+	}
+
+	return &resendSender{client: newResendClient(secret)}, nil
+}
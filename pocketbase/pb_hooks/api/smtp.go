@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/netguard"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// smtpSender relays outbound mail through a plain SMTP server. Port 465 uses
+// implicit TLS, any other port upgrades with STARTTLS when the server offers it.
+type smtpSender struct {
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func (s *smtpSender) Send(email *OutboundEmail) (string, error) {
+	from, err := mail.ParseAddress(email.From)
+	if err != nil {
+		return "", err
+	}
+
+	messageId := fmt.Sprintf("<%s@%s>", security.RandomString(24), from.Address[strings.LastIndex(from.Address, "@")+1:])
+	message, err := buildMIMEMessage(email, messageId)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return "", err
+	}
+	if err := client.Rcpt(email.To); err != nil {
+		return "", err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(message); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return messageId, client.Quit()
+}
+
+func (s *smtpSender) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.host, s.port)
+	tlsConfig := &tls.Config{ServerName: s.host}
+
+	// the host is user supplied, so only public addresses are dialed
+	dialer := netguard.Dialer(smtpTimeout)
+
+	var conn net.Conn
+	var err error
+	if s.port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(2 * smtpTimeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.port != "465" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
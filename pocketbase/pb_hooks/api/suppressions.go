@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+const (
+	SuppressionReasonHardBounce = "hard_bounce"
+	SuppressionReasonComplaint  = "complaint"
+)
+
+// isSuppressed reports whether the address is on the user's suppression list.
+func isSuppressed(app core.App, userId, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	_, err := app.FindFirstRecordByFilter(collections.Suppressions, "user = {:user} && email = {:email}", dbx.Params{
+		"user":  userId,
+		"email": strings.ToLower(email),
+	})
+	return err == nil
+}
+
+// suppressRecipient puts a recipient that hard bounced or complained on the
+// owner's suppression list. Rules forwarding to it are paused, destinations
+// sending to it are disabled and the owner gets an email about it. Deleting
+// the suppression undoes both.
+func suppressRecipient(app core.App, event *core.Record, recipient, reason string) error {
+	userId := event.GetString("user")
+	recipient = strings.ToLower(recipient)
+	if recipient == "" || isSuppressed(app, userId, recipient) {
+		return nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId(collections.Suppressions)
+	if err != nil {
+		return err
+	}
+
+	pausedRules := []string{}
+	disabledDestinations := []string{}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		rules, err := txApp.FindAllRecords(
+			collections.ForwardingRules,
+			dbx.HashExp{"user": userId, "enabled": true},
+			dbx.NewExp("LOWER(forward_to_email) = {:email}", dbx.Params{"email": recipient}),
+		)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			rule.Set("enabled", false)
+			if err := txApp.Save(rule); err != nil {
+				return err
+			}
+			pausedRules = append(pausedRules, rule.Id)
+		}
+
+		destinations, err := txApp.FindAllRecords(
+			collections.RuleDestinations,
+			dbx.HashExp{"user": userId, "enabled": true, "type": DestinationTypeEmail},
+			dbx.NewExp("LOWER(email) = {:email}", dbx.Params{"email": recipient}),
+		)
+		if err != nil {
+			return err
+		}
+		for _, destination := range destinations {
+			destination.Set("enabled", false)
+			if err := txApp.Save(destination); err != nil {
+				return err
+			}
+			disabledDestinations = append(disabledDestinations, destination.Id)
+		}
+
+		suppression := core.NewRecord(collection)
+		suppression.Set("user", userId)
+		suppression.Set("email", recipient)
+		suppression.Set("reason", reason)
+		suppression.Set("rule", event.GetString("rule"))
+		suppression.Set("forwarding_event", event.Id)
+		suppression.Set("paused_rules", pausedRules)
+		suppression.Set("disabled_destinations", disabledDestinations)
+		return txApp.Save(suppression)
+	})
+	if err != nil {
+		return err
+	}
+
+	logEvent(app, userId, event.GetString("rule"), event.Id, EventRecipientSuppressed, map[string]any{
+		"email":                 recipient,
+		"reason":                reason,
+		"paused_rules":          pausedRules,
+		"disabled_destinations": disabledDestinations,
+	})
+
+	notifySuppression(app, userId, recipient, reason, len(pausedRules)+len(disabledDestinations))
+
+	return nil
+}
+
+// unsuppressRecipient re-enables the rules and destinations a deleted
+// suppression paused, unless they were deleted or changed in the meantime.
+func unsuppressRecipient(app core.App, suppression *core.Record) error {
+	userId := suppression.GetString("user")
+	email := suppression.GetString("email")
+
+	var pausedRules, disabledDestinations []string
+	if err := suppression.UnmarshalJSONField("paused_rules", &pausedRules); err != nil {
+		pausedRules = nil
+	}
+	if err := suppression.UnmarshalJSONField("disabled_destinations", &disabledDestinations); err != nil {
+		disabledDestinations = nil
+	}
+
+	for _, ruleId := range pausedRules {
+		rule, err := app.FindRecordById(collections.ForwardingRules, ruleId)
+		if err != nil || !strings.EqualFold(rule.GetString("forward_to_email"), email) {
+			continue
+		}
+		rule.Set("enabled", true)
+		if err := app.Save(rule); err != nil {
+			return err
+		}
+	}
+
+	for _, destinationId := range disabledDestinations {
+		destination, err := app.FindRecordById(collections.RuleDestinations, destinationId)
+		if err != nil || !strings.EqualFold(destination.GetString("email"), email) {
+			continue
+		}
+		destination.Set("enabled", true)
+		if err := app.Save(destination); err != nil {
+			return err
+		}
+	}
+
+	logEvent(app, userId, suppression.GetString("rule"), "", EventRecipientUnsuppressed, map[string]any{
+		"email":                 email,
+		"reason":                suppression.GetString("reason"),
+		"paused_rules":          pausedRules,
+		"disabled_destinations": disabledDestinations,
+	})
+
+	return nil
+}
+
+func notifySuppression(app core.App, userId, recipient, reason string, paused int) {
+	user, err := app.FindRecordById(collections.Users, userId)
+	if err != nil || user.Email() == "" {
+		return
+	}
+
+	cause := "hard bounced"
+	if reason == SuppressionReasonComplaint {
+		cause = "marked a forwarded email as spam"
+	}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: user.Email()}},
+		Subject: "Forwarding to " + recipient + " was paused",
+		Text: fmt.Sprintf(
+			"%s %s, so it was added to your suppression list and %d rule(s) or destination(s) forwarding to it were paused.\n\n"+
+				"Remove %s from your suppression list to resume forwarding.",
+			recipient, cause, paused, recipient,
+		),
+	}
+
+	if err := app.NewMailClient().Send(message); err != nil {
+		app.Logger().Error("Failed to send suppression notice: ", "user_id", userId, "err", err)
+	}
+}
+
+// bouncedRecipient returns the address an outbound email was sent to, from
+// its delivery or, for events without deliveries, the webhook payload.
+func bouncedRecipient(delivery *core.Record, to []string) string {
+	if delivery != nil {
+		return delivery.GetString("recipient")
+	}
+	if len(to) > 0 {
+		return to[0]
+	}
+	return ""
+}
@@ -71,3 +71,79 @@ type EmailFailedWebhook struct {
 		Tags map[string]string `json:"tags,omitempty"`
 	} `json:"data"`
 }
+
+type EmailBouncedWebhook struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID   string   `json:"email_id"`
+		CreatedAt string   `json:"created_at"`
+		From      string   `json:"from"`
+		To        []string `json:"to"`
+		Subject   string   `json:"subject"`
+		Bounce    struct {
+			Message string `json:"message"`
+			SubType string `json:"subType"`
+			Type    string `json:"type"`
+		} `json:"bounce"`
+		Tags map[string]string `json:"tags,omitempty"`
+	} `json:"data"`
+}
+
+type EmailComplainedWebhook struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID   string            `json:"email_id"`
+		CreatedAt string            `json:"created_at"`
+		From      string            `json:"from"`
+		To        []string          `json:"to"`
+		Subject   string            `json:"subject"`
+		Tags      map[string]string `json:"tags,omitempty"`
+	} `json:"data"`
+}
+
+type EmailDeliveryDelayedWebhook struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID   string            `json:"email_id"`
+		CreatedAt string            `json:"created_at"`
+		From      string            `json:"from"`
+		To        []string          `json:"to"`
+		Subject   string            `json:"subject"`
+		Tags      map[string]string `json:"tags,omitempty"`
+	} `json:"data"`
+}
+
+type EmailOpenedWebhook struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID   string            `json:"email_id"`
+		CreatedAt string            `json:"created_at"`
+		From      string            `json:"from"`
+		To        []string          `json:"to"`
+		Subject   string            `json:"subject"`
+		Tags      map[string]string `json:"tags,omitempty"`
+	} `json:"data"`
+}
+
+type EmailClickedWebhook struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID   string   `json:"email_id"`
+		CreatedAt string   `json:"created_at"`
+		From      string   `json:"from"`
+		To        []string `json:"to"`
+		Subject   string   `json:"subject"`
+		Click     struct {
+			IpAddress string `json:"ipAddress"`
+			Link      string `json:"link"`
+			Timestamp string `json:"timestamp"`
+			UserAgent string `json:"userAgent"`
+		} `json:"click"`
+		Tags map[string]string `json:"tags,omitempty"`
+	} `json:"data"`
+}
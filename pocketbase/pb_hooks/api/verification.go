@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/secrets"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	svix "github.com/svix/svix-webhooks/go"
+)
+
+const (
+	AuditWebhookRejected = "webhook.rejected"
+
+	RejectedUnknownToken     = "unknown_token"
+	RejectedSecretNotFound   = "webhook_secret_not_found"
+	RejectedSecretInvalid    = "webhook_secret_invalid"
+	RejectedInvalidSignature = "invalid_signature"
+)
+
+var rejectionMessages = map[string]string{
+	RejectedUnknownToken:     "webhook endpoint not found",
+	RejectedSecretNotFound:   "webhook secret not found",
+	RejectedSecretInvalid:    "webhook secret can't be used to verify signatures",
+	RejectedInvalidSignature: "invalid webhook signature",
+}
+
+// webhookEnvelope is the part every Resend webhook payload has in common.
+type webhookEnvelope struct {
+	Type string `json:"type"`
+	Data struct {
+		EmailID string `json:"email_id"`
+	} `json:"data"`
+}
+
+// verifiedAccounts maps the users a webhook was verified for to the Resend
+// account, the webhook secret record, whose secret verified it.
+type verifiedAccounts map[string]*core.Record
+
+// verifyWebhookSignature checks the svix signature of the request against the
+// secret of a Resend account. It only reads, so a rejected request leaves no
+// trace in the user's data. It returns a zero status on success and otherwise
+// the HTTP status to respond with and the rejection reason.
+func verifyWebhookSignature(e *core.RequestEvent, account *core.Record, bodyBytes []byte) (int, string) {
+	if account.GetString("secret") == "" {
+		return 404, RejectedSecretNotFound
+	}
+
+	secret, err := secrets.Decrypt(account.GetString("secret"))
+	if err != nil {
+		e.App.Logger().Error("Failed to decrypt webhook secret: ", "webhook_secret_id", account.Id, "err", err)
+		return 500, RejectedSecretInvalid
+	}
+
+	wh, err := svix.NewWebhook(secret)
+	if err != nil {
+		e.App.Logger().Error("Failed to create svix webhook: ", "webhook_secret_id", account.Id, "err", err)
+		return 500, RejectedSecretInvalid
+	}
+
+	if err := wh.Verify(bodyBytes, e.Request.Header); err != nil {
+		return 401, RejectedInvalidSignature
+	}
+
+	return 0, ""
+}
+
+// verifyUserWebhookSignature checks the signature against every Resend account
+// of the user and returns the account that verified it.
+func verifyUserWebhookSignature(e *core.RequestEvent, userId string, bodyBytes []byte) (*core.Record, int, string) {
+	accounts, err := e.App.FindAllRecords(collections.ResendWebhookSecrets, dbx.HashExp{"user": userId})
+	if err != nil || len(accounts) == 0 {
+		return nil, 404, RejectedSecretNotFound
+	}
+
+	status, reason := 0, ""
+	for _, account := range accounts {
+		if status, reason = verifyWebhookSignature(e, account, bodyBytes); status == 0 {
+			return account, 0, ""
+		}
+	}
+
+	return nil, status, reason
+}
+
+// webhookUsers returns the users a webhook on the shared endpoint may belong
+// to: the owners of rules on the domains a received email was sent to, or the
+// owner of the forwarding event a status webhook is about.
+func webhookUsers(app core.App, webhookType string, bodyBytes []byte) ([]string, error) {
+	users := []string{}
+
+	switch webhookType {
+	case WebhookTypeReceived:
+		var payload EmailReceivedWebhook
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			return users, nil
+		}
+
+		return findRuleOwners(app, collectRecipients(payload.Data.To, payload.Data.Cc, payload.Data.Bcc))
+	case WebhookTypeSent, WebhookTypeDelivered, WebhookTypeFailed, WebhookTypeBounced,
+		WebhookTypeComplained, WebhookTypeDelayed, WebhookTypeOpened, WebhookTypeClicked:
+		var payload webhookEnvelope
+		if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+			return users, nil
+		}
+
+		if event, _, err := findForwardingEventBySentEmailID(app, payload.Data.EmailID); err == nil {
+			users = append(users, event.GetString("user"))
+		}
+	}
+
+	return users, nil
+}
+
+// findAccountForwardingEvent is findForwardingEventBySentEmailID limited to
+// the events of the users a webhook was verified for.
+func findAccountForwardingEvent(app core.App, accounts verifiedAccounts, sentEmailID string) (*core.Record, *core.Record, error) {
+	event, delivery, err := findForwardingEventBySentEmailID(app, sentEmailID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if accounts[event.GetString("user")] == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	return event, delivery, nil
+}
+
+// auditRejectedWebhook records a webhook request that was refused in the
+// security audit log, which only superusers can read, instead of the logs of
+// the account it claimed to belong to.
+func auditRejectedWebhook(e *core.RequestEvent, userId, reason string, bodyBytes []byte) {
+	e.App.Logger().Warn("Rejected webhook: ", "reason", reason, "user_id", userId, "ip", e.RealIP())
+
+	metadata := map[string]any{}
+	var payload webhookEnvelope
+	if err := json.Unmarshal(bodyBytes, &payload); err == nil {
+		metadata["type"] = payload.Type
+		metadata["email_id"] = payload.Data.EmailID
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId(collections.SecurityAuditLogs)
+	if err != nil {
+		e.App.Logger().Error("Failed to find security audit logs collection: ", "err", err)
+		return
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("type", AuditWebhookRejected)
+	record.Set("reason", reason)
+	record.Set("user", userId)
+	record.Set("path", e.Request.URL.Path)
+	record.Set("ip", e.RealIP())
+	record.Set("user_agent", e.Request.UserAgent())
+	record.Set("svix_id", e.Request.Header.Get("svix-id"))
+	record.Set("metadata", metadata)
+	if err := e.App.Save(record); err != nil {
+		e.App.Logger().Error("Failed to save security audit log: ", "reason", reason, "err", err)
+	}
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/netguard"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/rules"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	AttachmentModeBase64 = "base64"
+	AttachmentModeLink   = "link"
+
+	attachmentLinkTTL = 7 * 24 * time.Hour
+)
+
+// webhookClient only connects to public addresses, destination urls are
+// user supplied
+var webhookClient = netguard.NewHTTPClient(30 * time.Second)
+
+// httpStatusError is returned for non-2xx responses of destination endpoints.
+// 5xx and 429 responses are retried like failed email sends.
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("destination responded with status %d", e.StatusCode)
+}
+
+type webhookAttachment struct {
+	Filename     string `json:"filename"`
+	ContentType  string `json:"content_type"`
+	ContentId    string `json:"content_id,omitempty"`
+	Size         int    `json:"size"`
+	Content      string `json:"content,omitempty"`
+	URL          string `json:"url,omitempty"`
+	URLExpiresAt string `json:"url_expires_at,omitempty"`
+}
+
+// webhookPayload is the normalized JSON body POSTed to webhook destinations.
+type webhookPayload struct {
+	Type            string              `json:"type"`
+	EventId         string              `json:"event_id"`
+	RuleId          string              `json:"rule_id"`
+	ReceivedEmailId string              `json:"received_email_id"`
+	ReceivedAt      string              `json:"received_at"`
+	From            string              `json:"from"`
+	To              string              `json:"to"`
+	Subject         string              `json:"subject"`
+	Headers         map[string]string   `json:"headers"`
+	Text            string              `json:"text"`
+	Html            string              `json:"html"`
+	Attachments     []webhookAttachment `json:"attachments"`
+}
+
+// deliverWebhook POSTs the email to a webhook destination, signed with the
+// rule's webhook secret. The response status is written to the event logs.
+func deliverWebhook(app core.App, event, rule, delivery *core.Record, content *messageContent, attempt int) error {
+	secret, err := ensureWebhookSecret(app, rule)
+	if err != nil {
+		return err
+	}
+
+	attachmentMode := AttachmentModeBase64
+	if destination, err := app.FindRecordById(collections.RuleDestinations, delivery.GetString("destination")); err == nil &&
+		destination.GetString("attachment_mode") == AttachmentModeLink {
+		attachmentMode = AttachmentModeLink
+	}
+	// links are served from the archived raw message
+	if event.GetString("raw_message") == "" {
+		attachmentMode = AttachmentModeBase64
+	}
+
+	payload := webhookPayload{
+		Type:            "email.forwarded",
+		EventId:         event.Id,
+		RuleId:          rule.Id,
+		ReceivedEmailId: event.GetString("received_email_id"),
+		ReceivedAt:      event.GetDateTime("created").String(),
+		From:            content.From,
+		To:              event.GetString("to"),
+		Subject:         content.Subject,
+		Headers:         content.Headers,
+		Text:            content.Text,
+		Html:            content.Html,
+		Attachments:     []webhookAttachment{},
+	}
+
+	expires := time.Now().Add(attachmentLinkTTL)
+	for i, attachment := range content.Attachments {
+		item := webhookAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			ContentId:   attachment.ContentId,
+			Size:        len(attachment.Content),
+		}
+		if attachmentMode == AttachmentModeLink {
+			item.URL = attachmentLink(app, event.Id, secret, i, expires)
+			item.URLExpiresAt = expires.UTC().Format(time.RFC3339)
+		} else {
+			item.Content = base64.StdEncoding.EncodeToString(attachment.Content)
+		}
+		payload.Attachments = append(payload.Attachments, item)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return postToDestination(app, event, rule, delivery, body, map[string]string{
+		"X-Webhook-Id":        delivery.Id,
+		"X-Webhook-Timestamp": timestamp,
+		"X-Webhook-Signature": "v1=" + signWebhookBody(secret, timestamp, body),
+	}, attempt)
+}
+
+// postToDestination POSTs a JSON body to the delivery's url and writes the
+// response status to the event logs. Non-2xx responses return httpStatusError.
+func postToDestination(app core.App, event, rule, delivery *core.Record, body []byte, headers map[string]string, attempt int) error {
+	endpoint := delivery.GetString("recipient")
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "resendforward-webhook")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	logEvent(app, event.GetString("user"), rule.Id, event.Id, EventWebhookResponse, map[string]any{
+		"url":         endpoint,
+		"status_code": resp.StatusCode,
+		"attempt":     attempt,
+		"delivery":    delivery.Id,
+	})
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of "<timestamp>.<body>", which
+// receivers recompute with the rule's webhook secret.
+func signWebhookBody(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ensureWebhookSecret returns the rule's webhook secret, generating one for
+// rules created before webhook destinations existed.
+func ensureWebhookSecret(app core.App, rule *core.Record) (string, error) {
+	if secret := rule.GetString("webhook_secret"); secret != "" {
+		return secret, nil
+	}
+
+	secret := rules.NewWebhookSecret()
+	rule.Set("webhook_secret", secret)
+	if err := app.Save(rule); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func attachmentSignature(secret, eventId string, index int, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d:%d", eventId, index, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func attachmentLink(app core.App, eventId, secret string, index int, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", attachmentSignature(secret, eventId, index, expires.Unix()))
+
+	return fmt.Sprintf(
+		"%s/api/forwarding-events/%s/attachments/%d?%s",
+		strings.TrimRight(app.Settings().Meta.AppURL, "/"),
+		eventId,
+		index,
+		query.Encode(),
+	)
+}
+
+// downloadAttachmentHandler serves a single attachment of an archived message
+// to holders of a signed link from a webhook payload.
+func downloadAttachmentHandler(e *core.RequestEvent) error {
+	event, err := e.App.FindRecordById(collections.ForwardingEvents, e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("attachment not found", nil)
+	}
+
+	rule, err := e.App.FindRecordById(collections.ForwardingRules, event.GetString("rule"))
+	if err != nil || rule.GetString("webhook_secret") == "" {
+		return e.NotFoundError("attachment not found", nil)
+	}
+
+	index, err := strconv.Atoi(e.Request.PathValue("index"))
+	if err != nil {
+		return e.NotFoundError("attachment not found", nil)
+	}
+
+	expires, err := strconv.ParseInt(e.Request.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return e.ForbiddenError("the attachment link has expired", nil)
+	}
+
+	signature := e.Request.URL.Query().Get("signature")
+	expected := attachmentSignature(rule.GetString("webhook_secret"), event.Id, index, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return e.ForbiddenError("invalid attachment signature", nil)
+	}
+
+	raw, err := readRawMessage(e.App, event)
+	if err != nil {
+		return e.NotFoundError("attachment not found", nil)
+	}
+
+	content, err := parseRawMessage(raw)
+	if err != nil || index < 0 || index >= len(content.Attachments) {
+		return e.NotFoundError("attachment not found", nil)
+	}
+
+	attachment := content.Attachments[index]
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	e.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	e.Response.Header().Set("Cache-Control", "private, no-store")
+	return e.Blob(http.StatusOK, contentType, attachment.Content)
+}
@@ -1,13 +1,21 @@
 package crons
 
 import (
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/api"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/jobs"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+const defaultRawMessageRetentionDays = 30
+
 func Init(app *pocketbase.PocketBase) error {
 	app.Cron().MustAdd("CleanUpEvents", "0 0 * * *", func() {
 		forwardingEventsCollection, err := app.FindCollectionByNameOrId(collections.ForwardingEvents)
@@ -31,5 +39,103 @@ func Init(app *pocketbase.PocketBase) error {
 		}
 	})
 
+	// raw messages are removed with their events after 30 days, or earlier
+	// when RAW_MESSAGE_RETENTION_DAYS is lower
+	app.Cron().MustAdd("CleanUpRawMessages", "15 0 * * *", func() {
+		retentionDays := defaultRawMessageRetentionDays
+		if n, err := strconv.Atoi(os.Getenv("RAW_MESSAGE_RETENTION_DAYS")); err == nil && n > 0 {
+			retentionDays = n
+		}
+
+		cutoffDate := time.Now().AddDate(0, 0, -retentionDays).UTC()
+		records, err := app.FindRecordsByFilter(collections.ForwardingEvents, "raw_message != '' && created < {:cutoff}", "", 0, 0, dbx.Params{
+			"cutoff": cutoffDate.Format(time.RFC3339),
+		})
+		if err != nil {
+			return
+		}
+
+		for _, record := range records {
+			record.Set("raw_message", "")
+			if err := app.Save(record); err != nil {
+				app.Logger().Error("Failed to remove raw message: ", "event_id", record.Id, "err", err)
+			}
+		}
+	})
+
+	app.Cron().MustAdd("CleanUpWebhookReceipts", "30 0 * * *", func() {
+		cutoffDate := time.Now().AddDate(0, 0, -30).UTC()
+		records, err := app.FindRecordsByFilter(collections.WebhookReceipts, "created < {:cutoff}", "", 0, 0, dbx.Params{
+			"cutoff": cutoffDate.Format(time.RFC3339),
+		})
+		if err != nil {
+			return
+		}
+
+		for _, record := range records {
+			err := app.Delete(record)
+			if err != nil {
+				continue
+			}
+		}
+	})
+
+	app.Cron().MustAdd("CleanUpSecurityAuditLogs", "0 1 * * *", func() {
+		cutoffDate := time.Now().AddDate(0, 0, -90).UTC()
+		records, err := app.FindRecordsByFilter(collections.SecurityAuditLogs, "created < {:cutoff}", "", 0, 0, dbx.Params{
+			"cutoff": cutoffDate.Format(time.RFC3339),
+		})
+		if err != nil {
+			return
+		}
+
+		for _, record := range records {
+			err := app.Delete(record)
+			if err != nil {
+				continue
+			}
+		}
+	})
+
+	app.Cron().MustAdd("ExpireQuarantine", "45 * * * *", func() {
+		records, err := app.FindRecordsByFilter(collections.Quarantine, "expires_at != '' && expires_at <= {:now}", "expires_at", 0, 0, dbx.Params{
+			"now": types.NowDateTime().String(),
+		})
+		if err != nil {
+			return
+		}
+
+		for _, record := range records {
+			if err := api.DeleteQuarantinedMessage(app, record, "expired"); err != nil {
+				app.Logger().Error("Failed to expire quarantined message: ", "quarantine_id", record.Id, "err", err)
+			}
+		}
+	})
+
+	app.Cron().MustAdd("RetryForwards", "* * * * *", func() {
+		records, err := app.FindRecordsByFilter(collections.ForwardingEvents, "status = {:status} && next_attempt_at <= {:now}", "next_attempt_at", 0, 0, dbx.Params{
+			"status": api.StatusRetrying,
+			"now":    types.NowDateTime().String(),
+		})
+		if err != nil {
+			return
+		}
+
+		for _, record := range records {
+			err := app.RunInTransaction(func(txApp core.App) error {
+				record.Set("status", api.StatusPending)
+				if err := txApp.Save(record); err != nil {
+					return err
+				}
+
+				_, err := jobs.Enqueue(txApp, jobs.TypeForward, record.GetString("user"), record.Id)
+				return err
+			})
+			if err != nil {
+				app.Logger().Error("Failed to requeue forwarding event: ", "event_id", record.Id, "err", err)
+			}
+		}
+	})
+
 	return nil
 }
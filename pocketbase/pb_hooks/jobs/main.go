@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	TypeForward = "forward"
+	TypeBounce  = "bounce"
+	TypeArchive = "archive"
+
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+
+	defaultWorkers = 4
+	pollInterval   = 2 * time.Second
+)
+
+// Handler processes a single claimed job. Returning an error marks the job as failed.
+type Handler func(app core.App, job *core.Record) error
+
+var (
+	handlers = map[string]Handler{}
+	wake     = make(chan struct{}, 1)
+
+	errPanic = errors.New("job handler panicked")
+)
+
+// Register binds a handler to a job type. It must be called before the server starts.
+func Register(jobType string, handler Handler) {
+	handlers[jobType] = handler
+}
+
+// Enqueue stores a new queued job for the given forwarding event and wakes up an idle worker.
+func Enqueue(app core.App, jobType, user, event string) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(collections.ForwardingJobs)
+	if err != nil {
+		return nil, err
+	}
+
+	job := core.NewRecord(collection)
+	job.Set("user", user)
+	job.Set("event", event)
+	job.Set("type", jobType)
+	job.Set("status", StatusQueued)
+	job.Set("attempts", 0)
+	job.Set("run_after", types.NowDateTime())
+
+	if err := app.Save(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+func Init(app *pocketbase.PocketBase) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		if err := requeueInterrupted(app); err != nil {
+			app.Logger().Error("Failed to requeue interrupted jobs: ", "err", err)
+		}
+
+		for i := 0; i < workerCount(); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				work(ctx, app)
+			}()
+		}
+
+		return se.Next()
+	})
+
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		cancel()
+		wg.Wait()
+		return e.Next()
+	})
+
+	return nil
+}
+
+func workerCount() int {
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultWorkers
+}
+
+// requeueInterrupted puts back jobs that were claimed by a worker of a previous
+// process that exited before finishing them.
+func requeueInterrupted(app core.App) error {
+	_, err := app.DB().Update(collections.ForwardingJobs, dbx.Params{
+		"status":    StatusQueued,
+		"locked_at": "",
+	}, dbx.HashExp{"status": StatusProcessing}).Execute()
+	return err
+}
+
+func work(ctx context.Context, app core.App) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			job, err := claim(app)
+			if err != nil {
+				app.Logger().Error("Failed to claim job: ", "err", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+
+			run(app, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim atomically moves the oldest due job from queued to processing.
+func claim(app core.App) (*core.Record, error) {
+	var job *core.Record
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		records, err := txApp.FindRecordsByFilter(
+			collections.ForwardingJobs,
+			"status = {:status} && run_after <= {:now}",
+			"run_after",
+			1,
+			0,
+			dbx.Params{"status": StatusQueued, "now": types.NowDateTime().String()},
+		)
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		job = records[0]
+		job.Set("status", StatusProcessing)
+		job.Set("locked_at", types.NowDateTime())
+		job.Set("attempts", job.GetInt("attempts")+1)
+
+		return txApp.Save(job)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func run(app core.App, job *core.Record) {
+	status := StatusCompleted
+	lastError := ""
+
+	handler, ok := handlers[job.GetString("type")]
+	if !ok {
+		status = StatusFailed
+		lastError = "no handler registered for job type " + job.GetString("type")
+	} else if err := safeHandle(app, handler, job); err != nil {
+		status = StatusFailed
+		lastError = err.Error()
+	}
+
+	job.Set("status", status)
+	job.Set("last_error", lastError)
+	job.Set("locked_at", "")
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("Failed to update job status: ", "job_id", job.Id, "err", err)
+	}
+}
+
+func safeHandle(app core.App, handler Handler, job *core.Record) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			app.Logger().Error("Job handler panicked: ", "job_id", job.Id, "panic", r)
+			err = errPanic
+		}
+	}()
+
+	return handler(app, job)
+}
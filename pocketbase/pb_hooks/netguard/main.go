@@ -0,0 +1,104 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for addresses outside the public internet.
+var ErrForbiddenAddress = errors.New("destination address is not allowed")
+
+// forbiddenPrefixes are non-public ranges that the checks of netip.Addr don't
+// cover.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// allowPrivate reports whether ALLOW_PRIVATE_DESTINATIONS lets self-hosted
+// instances deliver to their own network.
+func allowPrivate() bool {
+	return os.Getenv("ALLOW_PRIVATE_DESTINATIONS") == "true"
+}
+
+// CheckAddr returns ErrForbiddenAddress for loopback, link-local, private and
+// other non-public addresses, which users must not make the server reach.
+func CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if allowPrivate() {
+		return nil
+	}
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return ErrForbiddenAddress
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+
+	return nil
+}
+
+// CheckHost resolves a host name and checks every address it resolves to. It
+// is meant for validating user input, connections are checked again when they
+// are made since DNS answers can change.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckAddr(addr)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err := CheckAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Dialer returns a dialer that refuses to connect to addresses rejected by
+// CheckAddr, after DNS resolution and for every connection, redirects
+// included.
+func Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return CheckAddr(addrPort.Addr())
+		},
+	}
+}
+
+// NewHTTPClient returns an http client for user supplied urls. It connects
+// directly, a proxy would hide the address it connects to from Dialer.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = Dialer(timeout).DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
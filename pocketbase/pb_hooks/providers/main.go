@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/netguard"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	TypeResend = "resend"
+	TypeSMTP   = "smtp"
+)
+
+func Init(app *pocketbase.PocketBase) error {
+	app.OnRecordCreateRequest(collections.DeliveryProviders).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateProvider(e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest(collections.DeliveryProviders).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateProvider(e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	// an account has at most one default provider, the latest one set wins
+	app.OnRecordAfterCreateSuccess(collections.DeliveryProviders).BindFunc(func(e *core.RecordEvent) error {
+		unsetOtherDefaults(e.App, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(collections.DeliveryProviders).BindFunc(func(e *core.RecordEvent) error {
+		unsetOtherDefaults(e.App, e.Record)
+		return e.Next()
+	})
+
+	return nil
+}
+
+func validateProvider(provider *core.Record) error {
+	switch provider.GetString("type") {
+	case TypeResend:
+		if provider.GetString("secret") == "" {
+			return errors.New("resend providers require an api key")
+		}
+	case TypeSMTP:
+		if provider.GetString("host") == "" {
+			return errors.New("smtp providers require a host")
+		}
+		if port := provider.GetInt("port"); port <= 0 || port > 65535 {
+			return errors.New("smtp providers require a valid port")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := netguard.CheckHost(ctx, provider.GetString("host")); errors.Is(err, netguard.ErrForbiddenAddress) {
+			return errors.New("smtp providers must use a public host")
+		} else if err != nil {
+			return errors.New("the smtp host can't be resolved")
+		}
+	}
+
+	return nil
+}
+
+func unsetOtherDefaults(app core.App, provider *core.Record) {
+	if !provider.GetBool("is_default") {
+		return
+	}
+
+	others, err := app.FindAllRecords(collections.DeliveryProviders,
+		dbx.HashExp{"user": provider.GetString("user"), "is_default": true},
+		dbx.Not(dbx.HashExp{"id": provider.Id}),
+	)
+	if err != nil {
+		app.Logger().Error("Failed to find default delivery providers: ", "user_id", provider.GetString("user"), "err", err)
+		return
+	}
+
+	for _, other := range others {
+		other.Set("is_default", false)
+		if err := app.Save(other); err != nil {
+			app.Logger().Error("Failed to unset default delivery provider: ", "provider_id", other.Id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	FieldSender         = "sender"
+	FieldSenderDomain   = "sender_domain"
+	FieldSubject        = "subject"
+	FieldHasAttachments = "has_attachments"
+	FieldHeader         = "header"
+	FieldSize           = "size"
+
+	ActionForward = "forward"
+	ActionDrop    = "drop"
+	ActionRoute   = "route"
+)
+
+// Condition is a single entry of a rule's ordered "conditions" list.
+//
+// sender and sender_domain compare case-insensitively and accept "*"
+// wildcards, subject and header values are regular expressions,
+// has_attachments takes "true" or "false" and size compares the message size
+// in bytes using the "gt" or "lt" operator.
+type Condition struct {
+	Field    string `json:"field"`
+	Header   string `json:"header,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value"`
+	Action   string `json:"action"`
+	RouteTo  string `json:"route_to,omitempty"`
+}
+
+// Message holds the parts of a received email that conditions look at.
+type Message struct {
+	From           string
+	Subject        string
+	Headers        map[string]string
+	HasAttachments bool
+	Size           int
+}
+
+// Conditions returns the parsed conditions of a forwarding rule.
+func Conditions(rule *core.Record) ([]Condition, error) {
+	raw := rule.GetString("conditions")
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+
+	conditions := []Condition{}
+	if err := json.Unmarshal([]byte(raw), &conditions); err != nil {
+		return nil, errors.New("conditions must be a list of condition objects")
+	}
+
+	return conditions, nil
+}
+
+// Evaluate returns the first condition matching msg and its position. When
+// nothing matches it returns -1 and a forward condition.
+func Evaluate(conditions []Condition, msg Message) (int, Condition) {
+	for i, condition := range conditions {
+		if condition.Matches(msg) {
+			return i, condition
+		}
+	}
+
+	return -1, Condition{Action: ActionForward}
+}
+
+func (c Condition) Validate() error {
+	switch c.Field {
+	case FieldSender, FieldSenderDomain:
+		if c.Value == "" {
+			return fmt.Errorf("%s condition requires a value", c.Field)
+		}
+	case FieldSubject:
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return fmt.Errorf("invalid subject pattern: %w", err)
+		}
+	case FieldHeader:
+		if c.Header == "" {
+			return errors.New("header condition requires a header name")
+		}
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return fmt.Errorf("invalid header pattern: %w", err)
+		}
+	case FieldHasAttachments:
+		if _, err := strconv.ParseBool(c.Value); err != nil {
+			return errors.New("has_attachments condition requires true or false")
+		}
+	case FieldSize:
+		if c.Operator != "gt" && c.Operator != "lt" {
+			return errors.New("size condition requires the gt or lt operator")
+		}
+		if _, err := strconv.Atoi(c.Value); err != nil {
+			return errors.New("size condition requires a number of bytes")
+		}
+	default:
+		return fmt.Errorf("unknown condition field %q", c.Field)
+	}
+
+	switch c.Action {
+	case ActionForward, ActionDrop:
+	case ActionRoute:
+		if _, err := mail.ParseAddress(c.RouteTo); err != nil {
+			return errors.New("route condition requires a valid route_to email")
+		}
+	default:
+		return fmt.Errorf("unknown condition action %q", c.Action)
+	}
+
+	return nil
+}
+
+// RouteAddress returns the bare, lower-cased address of route_to, which may
+// also be written with a display name. It is "" when route_to is invalid.
+func (c Condition) RouteAddress() string {
+	parsed, err := mail.ParseAddress(c.RouteTo)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Address)
+}
+
+func (c Condition) Matches(msg Message) bool {
+	switch c.Field {
+	case FieldSender:
+		return MatchWildcard(strings.ToLower(c.Value), senderAddress(msg.From))
+	case FieldSenderDomain:
+		address := senderAddress(msg.From)
+		return MatchWildcard(strings.ToLower(c.Value), address[strings.LastIndex(address, "@")+1:])
+	case FieldSubject:
+		return matchRegexp(c.Value, msg.Subject)
+	case FieldHeader:
+		for name, value := range msg.Headers {
+			if strings.EqualFold(name, c.Header) && matchRegexp(c.Value, value) {
+				return true
+			}
+		}
+		return false
+	case FieldHasAttachments:
+		expected, err := strconv.ParseBool(c.Value)
+		return err == nil && expected == msg.HasAttachments
+	case FieldSize:
+		limit, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return false
+		}
+		if c.Operator == "gt" {
+			return msg.Size > limit
+		}
+		return msg.Size < limit
+	}
+
+	return false
+}
+
+func senderAddress(from string) string {
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		return strings.ToLower(parsed.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
+
+func matchRegexp(pattern, value string) bool {
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(value)
+}
+
+// MatchWildcard reports whether value matches pattern, where "*" matches any
+// (possibly empty) sequence of characters.
+func MatchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	FilterAllow = "allow"
+	FilterBlock = "block"
+)
+
+// FilterSender decides whether mail from the sender is blocked by the allow
+// and block lists of a rule and of its account. A pattern with an "@" matches
+// the whole address, one without matches the sender's domain, and both accept
+// "*" wildcards.
+//
+// Rule entries are checked before account entries and, within a scope, block
+// entries before allow entries, so the first match decides. When no entry
+// matches but allow entries exist, the sender is blocked as well. The returned
+// entry is the one that blocked the sender, nil when it was blocked for not
+// being allowed.
+func FilterSender(ruleFilters, accountFilters []*core.Record, from string) (bool, *core.Record) {
+	address := senderAddress(from)
+	hasAllow := false
+
+	for _, filters := range [][]*core.Record{ruleFilters, accountFilters} {
+		for _, action := range []string{FilterBlock, FilterAllow} {
+			for _, filter := range filters {
+				if filter.GetString("action") != action {
+					continue
+				}
+				if action == FilterAllow {
+					hasAllow = true
+				}
+				if MatchSender(filter.GetString("pattern"), address) {
+					return action == FilterBlock, filter
+				}
+			}
+		}
+	}
+
+	return hasAllow, nil
+}
+
+// MatchSender reports whether a sender address matches an allow or block list
+// pattern.
+func MatchSender(pattern, address string) bool {
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, "@"))
+	address = strings.ToLower(address)
+
+	if strings.Contains(pattern, "@") {
+		return MatchWildcard(pattern, address)
+	}
+
+	return MatchWildcard(pattern, address[strings.LastIndex(address, "@")+1:])
+}
+
+// validateSenderFilter normalizes the filter pattern and checks that a rule
+// scoped filter belongs to a rule of the same user.
+func validateSenderFilter(app core.App, filter *core.Record) error {
+	pattern := strings.ToLower(strings.TrimSpace(filter.GetString("pattern")))
+	if pattern == "" || strings.ContainsAny(pattern, " \t<>,") || strings.Count(pattern, "@") > 1 {
+		return errors.New("pattern must be an address, a domain or a wildcard pattern such as *@example.com")
+	}
+	filter.Set("pattern", pattern)
+
+	ruleId := filter.GetString("rule")
+	if ruleId == "" {
+		return nil
+	}
+
+	rule, err := app.FindRecordById(collections.ForwardingRules, ruleId)
+	if err != nil || rule.GetString("user") != filter.GetString("user") {
+		return errors.New("rule not found")
+	}
+
+	return nil
+}
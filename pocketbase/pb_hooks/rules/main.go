@@ -1,10 +1,19 @@
 package rules
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
 	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/lsherman98/resendforward/pocketbase/pb_hooks/netguard"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
 )
 
 func Init(app *pocketbase.PocketBase) error {
@@ -27,8 +36,195 @@ func Init(app *pocketbase.PocketBase) error {
 			}
 		}
 
+		if err := validateRuleEmail(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		if err := validateConditions(e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		if err := validateProvider(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		if e.Record.GetString("webhook_secret") == "" {
+			e.Record.Set("webhook_secret", NewWebhookSecret())
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest(collections.ForwardingRules).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateRuleEmail(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		if err := validateConditions(e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		if err := validateProvider(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordCreateRequest(collections.SenderFilters).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateSenderFilter(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest(collections.SenderFilters).BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Record.GetString("user") != e.Record.Original().GetString("user") {
+			return e.BadRequestError("the user of a sender filter can't be changed", nil)
+		}
+
+		if err := validateSenderFilter(app, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordCreateRequest(collections.RuleDestinations).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateDestination(e.App, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest(collections.RuleDestinations).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := validateDestination(e.App, e.Record); err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
 		return e.Next()
 	})
 
 	return nil
 }
+
+// NewWebhookSecret returns a random secret for signing webhook deliveries.
+func NewWebhookSecret() string {
+	return "whsec_" + security.RandomString(32)
+}
+
+// validateRuleEmail checks the wildcard and catch-all constraints of a rule:
+// "*" is only allowed in the local part, catch-all rules use a plain address
+// and a user has at most one catch-all rule per domain. Other users' rules are
+// ignored, they are matched separately.
+func validateRuleEmail(app core.App, rule *core.Record) error {
+	ruleEmail := strings.ToLower(rule.GetString("rule_email"))
+	at := strings.LastIndex(ruleEmail, "@")
+	if at < 0 {
+		return errors.New("invalid rule email")
+	}
+	domain := ruleEmail[at+1:]
+
+	if strings.Contains(domain, "*") {
+		return errors.New("wildcards are only allowed before the @")
+	}
+
+	if !rule.GetBool("catch_all") {
+		return nil
+	}
+
+	if strings.Contains(ruleEmail, "*") {
+		return errors.New("a catch-all rule cannot contain wildcards")
+	}
+
+	existing, err := app.FindAllRecords(collections.ForwardingRules,
+		dbx.HashExp{"catch_all": true, "user": rule.GetString("user")},
+		dbx.NewExp("LOWER([[rule_email]]) LIKE {:domain}", dbx.Params{"domain": "%@" + domain}),
+		dbx.Not(dbx.HashExp{"id": rule.Id}),
+	)
+	if err != nil {
+		return errors.New("something went wrong")
+	}
+
+	for _, other := range existing {
+		if strings.HasSuffix(strings.ToLower(other.GetString("rule_email")), "@"+domain) {
+			return errors.New("you already have a catch-all rule for " + domain)
+		}
+	}
+
+	return nil
+}
+
+func validateConditions(rule *core.Record) error {
+	conditions, err := Conditions(rule)
+	if err != nil {
+		return err
+	}
+
+	for i, condition := range conditions {
+		if err := condition.Validate(); err != nil {
+			return fmt.Errorf("condition %d: %w", i+1, err)
+		}
+		if condition.Action == ActionRoute {
+			conditions[i].RouteTo = condition.RouteAddress()
+		}
+	}
+	if len(conditions) > 0 {
+		rule.Set("conditions", conditions)
+	}
+
+	return nil
+}
+
+// validateProvider makes sure a rule only sends through its owner's delivery
+// providers.
+func validateProvider(app core.App, rule *core.Record) error {
+	providerId := rule.GetString("provider")
+	if providerId == "" {
+		return nil
+	}
+
+	provider, err := app.FindRecordById(collections.DeliveryProviders, providerId)
+	if err != nil || provider.GetString("user") != rule.GetString("user") {
+		return errors.New("delivery provider not found")
+	}
+
+	return nil
+}
+
+// validateDestination checks that a destination belongs to a rule of its own
+// user and has the address its type delivers to. Urls must use https and
+// point to a public host, the server posts to them.
+func validateDestination(app core.App, destination *core.Record) error {
+	rule, err := app.FindRecordById(collections.ForwardingRules, destination.GetString("rule"))
+	if err != nil || rule.GetString("user") != destination.GetString("user") {
+		return errors.New("forwarding rule not found")
+	}
+
+	switch destination.GetString("type") {
+	case "email":
+		if destination.GetString("email") == "" {
+			return errors.New("email destinations require an email")
+		}
+	case "webhook", "slack", "discord":
+		target, err := url.Parse(destination.GetString("url"))
+		if err != nil || target.Scheme != "https" || target.Hostname() == "" {
+			if destination.GetString("type") == "webhook" {
+				return errors.New("webhook destinations require an https url")
+			}
+			return fmt.Errorf("%s destinations require an https incoming webhook url", destination.GetString("type"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := netguard.CheckHost(ctx, target.Hostname()); errors.Is(err, netguard.ErrForbiddenAddress) {
+			return errors.New("the destination url must point to a public host")
+		} else if err != nil {
+			return errors.New("the destination host can't be resolved")
+		}
+	}
+
+	return nil
+}
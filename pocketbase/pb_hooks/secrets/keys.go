@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// encryptionKey is one of the keys credentials are encrypted with. Ciphertexts
+// of a versioned key are prefixed with its id, e.g. "2024-06:<ciphertext>".
+type encryptionKey struct {
+	id  string
+	key string
+}
+
+// keys holds the active encryption keys, the first one being the current key
+// new ciphertexts are written with.
+var keys []encryptionKey
+
+// loadKeys reads the active keys from AES_KEYS, a comma separated list of
+// "id:key" pairs with the newest key first. The unversioned AES_KEY is kept
+// for ciphertexts written before key rotation was set up and is used for new
+// ones when AES_KEYS isn't set.
+func loadKeys() error {
+	loaded := []encryptionKey{}
+	seen := map[string]bool{}
+
+	for _, entry := range strings.Split(os.Getenv("AES_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, key, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return fmt.Errorf("AES_KEYS entry %q must be in the form id:key", entry)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("AES_KEYS key %q must be 32 characters", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("AES_KEYS key %q is listed more than once", id)
+		}
+		seen[id] = true
+
+		loaded = append(loaded, encryptionKey{id: id, key: key})
+	}
+
+	if key := os.Getenv("AES_KEY"); key != "" {
+		if len(key) != 32 {
+			return errors.New("AES_KEY must be 32 characters")
+		}
+		loaded = append(loaded, encryptionKey{key: key})
+	}
+
+	if len(loaded) == 0 {
+		return errors.New("AES_KEY or AES_KEYS must be set")
+	}
+
+	keys = loaded
+	return nil
+}
+
+// Encrypt encrypts a credential with the current key before it is stored.
+func Encrypt(value string) (string, error) {
+	if len(keys) == 0 {
+		return "", errors.New("no encryption keys loaded")
+	}
+	current := keys[0]
+
+	encrypted, err := security.Encrypt([]byte(value), current.key)
+	if err != nil {
+		return "", err
+	}
+
+	if current.id == "" {
+		return encrypted, nil
+	}
+	return current.id + ":" + encrypted, nil
+}
+
+// Decrypt reverses Encrypt with the key the value was encrypted with.
+func Decrypt(value string) (string, error) {
+	key, err := keyFor(value)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := security.Decrypt(strings.TrimPrefix(value, key.id+":"), key.key)
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
+
+// keyFor returns the key a ciphertext was encrypted with. Ciphertexts are
+// base64 encoded, so only versioned ones contain a ":".
+func keyFor(value string) (encryptionKey, error) {
+	id, _, versioned := strings.Cut(value, ":")
+	if !versioned {
+		id = ""
+	}
+
+	for _, key := range keys {
+		if key.id == id {
+			return key, nil
+		}
+	}
+
+	if id == "" {
+		return encryptionKey{}, errors.New("value was encrypted with AES_KEY, which is not set")
+	}
+	return encryptionKey{}, fmt.Errorf("encryption key %q is not in AES_KEYS", id)
+}
+
+// isCurrent reports whether the value is encrypted with the current key.
+func isCurrent(value string) bool {
+	key, err := keyFor(value)
+	return err == nil && key.id == keys[0].id
+}
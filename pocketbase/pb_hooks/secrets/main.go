@@ -1,46 +1,237 @@
 package secrets
 
 import (
-	"os"
+	"strings"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/lsherman98/resendforward/pocketbase/collections"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 func Init(app *pocketbase.PocketBase) error {
+	if err := loadKeys(); err != nil {
+		return err
+	}
+
 	app.OnRecordCreateRequest(collections.ResendAPIKeys).BindFunc(func(e *core.RecordRequestEvent) error {
-		key := e.Record.GetString("key")
-		if key == "" {
-			return e.BadRequestError("no resend api key found in request", nil)
+		if err := verifyAPIKey(e); err != nil {
+			return err
 		}
 
-		encryptedKey, err := security.Encrypt([]byte(key), os.Getenv("AES_KEY"))
-		if err != nil {
+		if err := encryptCredential(e.Record, "key"); err != nil {
 			e.App.Logger().Error("Failed to encrypt resend api key: ", "err", err)
 			return e.InternalServerError("failed to encrypt resend api key", nil)
 		}
 
-		e.Record.Set("key", encryptedKey)
 		return e.Next()
 	})
 
+	app.OnRecordUpdateRequest(collections.ResendAPIKeys).BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Record.GetString("key") == e.Record.Original().GetString("key") {
+			return e.Next()
+		}
+
+		if err := verifyAPIKey(e); err != nil {
+			return err
+		}
+
+		if err := encryptCredential(e.Record, "key"); err != nil {
+			e.App.Logger().Error("Failed to encrypt resend api key: ", "err", err)
+			return e.InternalServerError("failed to encrypt resend api key", nil)
+		}
+
+		return e.Next()
+	})
+
+	// every webhook secret record is a Resend account with its own webhook URL.
+	// The token in the URL is generated here and changed by rotating the URL,
+	// never through the record itself.
 	app.OnRecordCreateRequest(collections.ResendWebhookSecrets).BindFunc(func(e *core.RecordRequestEvent) error {
-		key := e.Record.GetString("secret")
-		if key == "" {
-			return e.BadRequestError("no resend webhook secret found in request", nil)
+		e.Record.Set("webhook_token", "")
+
+		if err := validateLinkedAPIKey(e); err != nil {
+			return err
+		}
+
+		// Resend only shows the secret once the webhook URL is added, so
+		// accounts can be created without one
+		if e.Record.GetString("secret") == "" {
+			return e.Next()
+		}
+
+		if err := verifyWebhookSecret(e); err != nil {
+			return err
 		}
 
-		encryptedKey, err := security.Encrypt([]byte(key), os.Getenv("AES_KEY"))
-		if err != nil {
+		if err := encryptCredential(e.Record, "secret"); err != nil {
 			e.App.Logger().Error("Failed to encrypt resend webhook secret: ", "err", err)
 			return e.InternalServerError("failed to encrypt resend webhook secret", nil)
 		}
 
-		e.Record.Set("secret", encryptedKey)
 		return e.Next()
 	})
 
+	app.OnRecordUpdateRequest(collections.ResendWebhookSecrets).BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("webhook_token", e.Record.Original().GetString("webhook_token"))
+
+		if err := validateLinkedAPIKey(e); err != nil {
+			return err
+		}
+
+		if e.Record.GetString("secret") == e.Record.Original().GetString("secret") {
+			return e.Next()
+		}
+
+		if err := verifyWebhookSecret(e); err != nil {
+			return err
+		}
+
+		if err := encryptCredential(e.Record, "secret"); err != nil {
+			e.App.Logger().Error("Failed to encrypt resend webhook secret: ", "err", err)
+			return e.InternalServerError("failed to encrypt resend webhook secret", nil)
+		}
+
+		return e.Next()
+	})
+
+	// neither the ciphertext nor the plaintext ever leaves the server, clients
+	// see the hint and rotated_at instead
+	app.OnRecordEnrich(collections.ResendAPIKeys).BindFunc(func(e *core.RecordEnrichEvent) error {
+		e.Record.Hide("key")
+		return e.Next()
+	})
+
+	app.OnRecordEnrich(collections.ResendWebhookSecrets).BindFunc(func(e *core.RecordEnrichEvent) error {
+		e.Record.Hide("secret")
+		return e.Next()
+	})
+
+	app.OnRecordEnrich(collections.DeliveryProviders).BindFunc(func(e *core.RecordEnrichEvent) error {
+		e.Record.Hide("secret")
+		return e.Next()
+	})
+
+	app.OnRecordCreateRequest(collections.DeliveryProviders).BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := encryptProviderSecret(e.Record); err != nil {
+			e.App.Logger().Error("Failed to encrypt delivery provider secret: ", "err", err)
+			return e.InternalServerError("failed to encrypt delivery provider secret", nil)
+		}
+
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest(collections.DeliveryProviders).BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Record.GetString("secret") == e.Record.Original().GetString("secret") {
+			return e.Next()
+		}
+
+		if err := encryptProviderSecret(e.Record); err != nil {
+			e.App.Logger().Error("Failed to encrypt delivery provider secret: ", "err", err)
+			return e.InternalServerError("failed to encrypt delivery provider secret", nil)
+		}
+
+		return e.Next()
+	})
+
+	return nil
+}
+
+// verifyAPIKey checks the API key of the request with Resend before it is
+// saved and records its permission.
+func verifyAPIKey(e *core.RecordRequestEvent) error {
+	key := strings.TrimSpace(e.Record.GetString("key"))
+	if key == "" {
+		return e.BadRequestError("no resend api key found in request", nil)
+	}
+
+	permission, err := checkResendAPIKey(key)
+	if err != nil {
+		return e.BadRequestError("invalid resend api key", validation.Errors{"key": err})
+	}
+
+	e.Record.Set("permission", permission)
+	return nil
+}
+
+// verifyWebhookSecret checks that the webhook secret of the request can
+// verify webhook signatures before it is saved.
+func verifyWebhookSecret(e *core.RecordRequestEvent) error {
+	secret := strings.TrimSpace(e.Record.GetString("secret"))
+	if secret == "" {
+		return e.BadRequestError("no resend webhook secret found in request", nil)
+	}
+
+	if err := checkWebhookSecret(secret); err != nil {
+		return e.BadRequestError("invalid resend webhook secret", validation.Errors{"secret": err})
+	}
+
+	return nil
+}
+
+// validateLinkedAPIKey checks that the API key linked to a Resend account
+// belongs to the account's user.
+func validateLinkedAPIKey(e *core.RecordRequestEvent) error {
+	apiKeyId := e.Record.GetString("api_key")
+	if apiKeyId == "" {
+		return nil
+	}
+
+	apiKey, err := e.App.FindRecordById(collections.ResendAPIKeys, apiKeyId)
+	if err != nil || apiKey.GetString("user") != e.Record.GetString("user") {
+		return e.BadRequestError("invalid resend api key", validation.Errors{
+			"api_key": validation.NewError("validation_api_key_not_found", "Resend API key not found."),
+		})
+	}
+
+	return nil
+}
+
+// encryptCredential encrypts the plaintext credential in field and records a
+// masked hint of it and when it was last rotated.
+func encryptCredential(record *core.Record, field string) error {
+	value := strings.TrimSpace(record.GetString(field))
+
+	encrypted, err := Encrypt(value)
+	if err != nil {
+		return err
+	}
+
+	record.Set(field, encrypted)
+	record.Set("hint", Hint(value))
+	record.Set("rotated_at", types.NowDateTime())
+	return nil
+}
+
+// Hint masks a credential for display, keeping its type prefix such as "re_"
+// or "whsec_" and the last four characters.
+func Hint(value string) string {
+	if len(value) < 12 {
+		return "••••"
+	}
+
+	prefix := ""
+	if i := strings.Index(value, "_"); i > 0 && i < 8 {
+		prefix = value[:i+1]
+	}
+
+	return prefix + "••••" + value[len(value)-4:]
+}
+
+// encryptProviderSecret encrypts the API key or SMTP password of a delivery
+// provider. SMTP relays without authentication have no secret.
+func encryptProviderSecret(record *core.Record) error {
+	secret := record.GetString("secret")
+	if secret == "" {
+		return nil
+	}
+
+	encryptedSecret, err := Encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	record.Set("secret", encryptedSecret)
 	return nil
 }
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"fmt"
+
+	"github.com/lsherman98/resendforward/pocketbase/collections"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// encryptedFields lists the encrypted field of every collection that stores
+// credentials.
+var encryptedFields = []struct {
+	collection string
+	field      string
+}{
+	{collections.ResendAPIKeys, "key"},
+	{collections.ResendWebhookSecrets, "secret"},
+	{collections.DeliveryProviders, "secret"},
+}
+
+// NewReencryptCommand returns the "reencrypt-secrets" command, which
+// re-encrypts every stored credential under the current key so that retired
+// keys can be removed from AES_KEYS.
+func NewReencryptCommand(app core.App) *cobra.Command {
+	return &cobra.Command{
+		Use:          "reencrypt-secrets",
+		Short:        "Re-encrypts all stored credentials with the newest AES key",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			for _, encrypted := range encryptedFields {
+				count, err := reencryptCollection(app, encrypted.collection, encrypted.field)
+				if err != nil {
+					return fmt.Errorf("%s: %w", encrypted.collection, err)
+				}
+				fmt.Printf("%s: re-encrypted %d records\n", encrypted.collection, count)
+			}
+
+			return nil
+		},
+	}
+}
+
+// reencryptCollection re-encrypts the field of every record that isn't
+// encrypted with the current key yet. All records of the collection are
+// updated in one transaction, so a failure leaves none of them changed.
+func reencryptCollection(app core.App, collection, field string) (int, error) {
+	count := 0
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		records, err := txApp.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			value := record.GetString(field)
+			if value == "" || isCurrent(value) {
+				continue
+			}
+
+			decrypted, err := Decrypt(value)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt record %s: %w", record.Id, err)
+			}
+
+			encrypted, err := Encrypt(decrypted)
+			if err != nil {
+				return err
+			}
+
+			// saved without the request hooks, which would encrypt the value again
+			record.Set(field, encrypted)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
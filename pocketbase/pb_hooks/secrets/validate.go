@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/resend/resend-go/v3"
+	svix "github.com/svix/svix-webhooks/go"
+)
+
+const (
+	PermissionFullAccess    = "full_access"
+	PermissionSendingAccess = "sending_access"
+)
+
+var resendHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// checkResendAPIKey verifies an API key by listing the account's domains and
+// returns its permission. Sending access keys are refused every endpoint but
+// sending, which Resend reports as a restricted key.
+func checkResendAPIKey(apiKey string) (string, error) {
+	if !strings.HasPrefix(apiKey, "re_") {
+		return "", validation.NewError("validation_invalid_resend_api_key", "Must be a Resend API key starting with re_.")
+	}
+
+	_, err := resend.NewCustomClient(resendHTTPClient, apiKey).Domains.List()
+	if err == nil {
+		return PermissionFullAccess, nil
+	}
+
+	if strings.Contains(strings.ToLower(err.Error()), "restricted") {
+		return PermissionSendingAccess, nil
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, resend.ErrRateLimit) {
+		return "", validation.NewError("validation_resend_unavailable", "Resend could not be reached to verify the key, please try again.")
+	}
+
+	return "", validation.NewError("validation_invalid_resend_api_key", "Resend rejected the key: "+strings.TrimPrefix(err.Error(), "[ERROR]: "))
+}
+
+// checkWebhookSecret verifies that a webhook secret is a svix signing secret,
+// like the whsec_ secrets Resend shows for its webhooks.
+func checkWebhookSecret(secret string) error {
+	if _, err := svix.NewWebhook(secret); err != nil {
+		return validation.NewError("validation_invalid_webhook_secret", "Must be the signing secret of a Resend webhook, starting with whsec_.")
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package smtpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultMaxSize = 25 << 20
+	maxRecipients  = 100
+	commandTimeout = 5 * time.Minute
+)
+
+// Envelope is a message accepted by the listener together with its SMTP
+// envelope.
+type Envelope struct {
+	RemoteAddr string
+	From       string
+	Recipients []string
+	Data       []byte
+}
+
+// Handler processes an accepted message. Returning an *Error replies with its
+// code, any other error is reported to the client as a temporary failure.
+type Handler func(app core.App, envelope *Envelope) error
+
+// Error is an SMTP reply returned by a Handler to reject a message.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+var handler Handler
+
+// Register sets the handler for accepted messages. It must be called before
+// the server starts.
+func Register(h Handler) {
+	handler = h
+}
+
+// Init starts an SMTP listener on SMTP_LISTEN_ADDR that accepts mail for the
+// comma separated SMTP_DOMAINS. Nothing is started when SMTP_LISTEN_ADDR is
+// empty.
+func Init(app *pocketbase.PocketBase) error {
+	addr := os.Getenv("SMTP_LISTEN_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	domains := map[string]bool{}
+	for _, domain := range strings.Split(os.Getenv("SMTP_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains[domain] = true
+		}
+	}
+	if len(domains) == 0 {
+		return errors.New("SMTP_DOMAINS is required when SMTP_LISTEN_ADDR is set")
+	}
+
+	maxSize := defaultMaxSize
+	if n, err := strconv.Atoi(os.Getenv("SMTP_MAX_MESSAGE_SIZE")); err == nil && n > 0 {
+		maxSize = n
+	}
+
+	hostname := os.Getenv("SMTP_HOSTNAME")
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	srv := &server{
+		app:      app,
+		hostname: hostname,
+		domains:  domains,
+		maxSize:  maxSize,
+	}
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		srv.listener = listener
+
+		app.Logger().Info("SMTP listener started", "addr", addr)
+		go srv.serve()
+
+		return se.Next()
+	})
+
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		srv.close()
+		return e.Next()
+	})
+
+	return nil
+}
+
+type server struct {
+	app      core.App
+	hostname string
+	domains  map[string]bool
+	maxSize  int
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	// conns are the open sessions, close interrupts them instead of waiting
+	// for idle clients to time out
+	mu      sync.Mutex
+	conns   map[net.Conn]bool
+	closing bool
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.app.Logger().Error("Failed to accept SMTP connection: ", "err", err)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if s.conns == nil {
+			s.conns = map[net.Conn]bool{}
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// close stops accepting connections and ends the open sessions at their next
+// read, so a message being delivered is still answered but idle clients don't
+// hold up the shutdown.
+func (s *server) close() {
+	if s.listener == nil {
+		return
+	}
+	s.listener.Close()
+
+	s.mu.Lock()
+	s.closing = true
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// setReadDeadline gives a session commandTimeout for its next read, none once
+// the server is closing.
+func (s *server) setReadDeadline(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		conn.SetReadDeadline(time.Now())
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(commandTimeout))
+}
+
+func (s *server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// session holds the state of a single SMTP transaction.
+type session struct {
+	from       string
+	hasFrom    bool
+	recipients []string
+}
+
+func (s *server) handle(netConn net.Conn) {
+	defer netConn.Close()
+
+	conn := textproto.NewConn(netConn)
+	reply := func(code int, message string) bool {
+		netConn.SetWriteDeadline(time.Now().Add(commandTimeout))
+		return conn.PrintfLine("%d %s", code, message) == nil
+	}
+
+	if !reply(220, s.hostname+" ESMTP ready") {
+		return
+	}
+
+	var tx session
+	for {
+		s.setReadDeadline(netConn)
+		line, err := conn.ReadLine()
+		if err != nil {
+			if s.isClosing() {
+				reply(421, s.hostname+" shutting down")
+			}
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			tx = session{}
+			reply(250, s.hostname)
+		case "EHLO":
+			tx = session{}
+			conn.PrintfLine("250-%s", s.hostname)
+			conn.PrintfLine("250-SIZE %d", s.maxSize)
+			reply(250, "8BITMIME")
+		case "MAIL":
+			address, ok := parsePath(arg, "FROM:")
+			if !ok {
+				reply(501, "syntax: MAIL FROM:<address>")
+				continue
+			}
+			tx = session{from: address, hasFrom: true}
+			reply(250, "OK")
+		case "RCPT":
+			if !tx.hasFrom {
+				reply(503, "need MAIL before RCPT")
+				continue
+			}
+			address, ok := parsePath(arg, "TO:")
+			if !ok || address == "" {
+				reply(501, "syntax: RCPT TO:<address>")
+				continue
+			}
+			if !s.domains[strings.ToLower(address[strings.LastIndex(address, "@")+1:])] {
+				reply(550, "relaying denied")
+				continue
+			}
+			if len(tx.recipients) >= maxRecipients {
+				reply(452, "too many recipients")
+				continue
+			}
+			tx.recipients = append(tx.recipients, address)
+			reply(250, "OK")
+		case "DATA":
+			if len(tx.recipients) == 0 {
+				reply(503, "need RCPT before DATA")
+				continue
+			}
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+
+			s.setReadDeadline(netConn)
+			dr := conn.DotReader()
+			data, err := io.ReadAll(io.LimitReader(dr, int64(s.maxSize)+1))
+			if err != nil {
+				return
+			}
+			if len(data) > s.maxSize {
+				// drain the rest of the message from the same reader, a new
+				// one would consume the commands following it
+				if _, err := io.Copy(io.Discard, dr); err != nil {
+					return
+				}
+				reply(552, "message exceeds maximum size")
+				tx = session{}
+				continue
+			}
+
+			code, message := s.deliver(netConn.RemoteAddr().String(), tx, data)
+			reply(code, message)
+			tx = session{}
+		case "RSET":
+			tx = session{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "VRFY":
+			reply(252, "cannot verify user")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func (s *server) deliver(remoteAddr string, tx session, data []byte) (int, string) {
+	if handler == nil {
+		return 451, "mail is not being accepted right now"
+	}
+
+	err := handler(s.app, &Envelope{
+		RemoteAddr: remoteAddr,
+		From:       tx.from,
+		Recipients: tx.recipients,
+		Data:       data,
+	})
+	if err == nil {
+		return 250, "OK: queued"
+	}
+
+	var smtpErr *Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code, smtpErr.Message
+	}
+
+	s.app.Logger().Error("Failed to handle SMTP message: ", "remote_addr", remoteAddr, "err", err)
+	return 451, "temporary failure, try again later"
+}
+
+// parsePath extracts the address from a MAIL FROM or RCPT TO argument,
+// ignoring any ESMTP parameters after it.
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		return "", false
+	}
+
+	end := strings.Index(path, ">")
+	if end < 0 {
+		return "", false
+	}
+
+	return path[1:end], true
+}
@@ -9,8 +9,12 @@ import {
 import { Button } from "@/components/ui/button";
 import { Alert, AlertDescription } from "@/components/ui/alert";
 import { Info, ExternalLink } from "lucide-react";
+import { getWebhookUrl } from "@/lib/utils";
+import { useGetResendWebhookSecret } from "@/lib/api/queries";
 
 export function SetupGuideDialog() {
+  const { data: webhookSecret } = useGetResendWebhookSecret();
+
   return (
     <Dialog>
       <DialogTrigger asChild>
@@ -81,9 +85,13 @@ export function SetupGuideDialog() {
                   <div className="space-y-3 text-primary">
                     <div>
                       <p className="font-medium mb-1">Webhook endpoint URL:</p>
-                      <code className="px-2 py-1 bg-muted rounded text-sm block w-fit">
-                        https://www.resendforward.com/api/webhooks/resend
-                      </code>
+                      {webhookSecret ? (
+                        <code className="px-2 py-1 bg-muted rounded text-sm block w-fit break-all">
+                          {getWebhookUrl(webhookSecret.webhook_token)}
+                        </code>
+                      ) : (
+                        <p className="text-sm">Generate your webhook URL in Settings.</p>
+                      )}
                     </div>
                     <div>
                       <p className="font-medium mb-1">Enable these events:</p>
@@ -9,11 +9,13 @@ import {
   DialogHeader,
   DialogTitle,
 } from "@/components/ui/dialog";
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from "@/components/ui/select";
 import { useUpdateForwardingRule } from "@/lib/api/mutations";
+import { useGetAuthenticationStatus } from "@/lib/api/queries";
 import { useState, useEffect } from "react";
 import { Loader2 } from "lucide-react";
 import { toast } from "sonner";
-import type { ForwardingRulesResponse } from "@/lib/pocketbase-types";
+import { ForwardingRulesAuthPolicyOptions, type ForwardingRulesResponse } from "@/lib/pocketbase-types";
 
 interface UpdateRuleProps {
   isOpen: boolean;
@@ -24,11 +26,13 @@ interface UpdateRuleProps {
 
 export function UpdateRule({ isOpen, onOpenChange, rule, onUpdateSuccess }: UpdateRuleProps) {
   const updateRule = useUpdateForwardingRule();
+  const { data: authenticationStatus } = useGetAuthenticationStatus();
   const [formData, setFormData] = useState({
     ruleName: "",
     ruleEmail: "",
     toEmail: "",
     fromEmail: "",
+    authPolicy: ForwardingRulesAuthPolicyOptions.forward,
   });
 
   useEffect(() => {
@@ -38,6 +42,7 @@ export function UpdateRule({ isOpen, onOpenChange, rule, onUpdateSuccess }: Upda
         ruleEmail: rule.rule_email,
         toEmail: rule.forward_to_email,
         fromEmail: rule.send_from_email,
+        authPolicy: rule.auth_policy || ForwardingRulesAuthPolicyOptions.forward,
       });
     }
   }, [rule]);
@@ -58,6 +63,7 @@ export function UpdateRule({ isOpen, onOpenChange, rule, onUpdateSuccess }: Upda
           rule_email: formData.ruleEmail,
           forward_to_email: formData.toEmail,
           send_from_email: formData.fromEmail,
+          auth_policy: formData.authPolicy,
         },
       });
       onOpenChange(false);
@@ -138,6 +144,34 @@ export function UpdateRule({ isOpen, onOpenChange, rule, onUpdateSuccess }: Upda
               The sender address for the forwarded email (must be verified in Resend)
             </p>
           </div>
+          <div className="space-y-2">
+            <Label htmlFor="auth-policy" className="text-primary">
+              Failed DMARC
+            </Label>
+            <Select
+              value={formData.authPolicy}
+              onValueChange={(value) =>
+                setFormData({ ...formData, authPolicy: value as ForwardingRulesAuthPolicyOptions })
+              }
+            >
+              <SelectTrigger id="auth-policy" className="w-full text-secondary">
+                <SelectValue />
+              </SelectTrigger>
+              <SelectContent>
+                <SelectItem value={ForwardingRulesAuthPolicyOptions.forward}>Forward</SelectItem>
+                <SelectItem value={ForwardingRulesAuthPolicyOptions.tag}>Tag the subject</SelectItem>
+                <SelectItem value={ForwardingRulesAuthPolicyOptions.quarantine}>Quarantine</SelectItem>
+              </SelectContent>
+            </Select>
+            {authenticationStatus && !authenticationStatus.configured ? (
+              <p className="text-xs text-destructive">
+                This has no effect yet: TRUSTED_AUTHSERV_IDS isn't configured on the server, so no email is
+                checked for DMARC
+              </p>
+            ) : (
+              <p className="text-xs text-muted-foreground">What happens to emails that fail DMARC</p>
+            )}
+          </div>
         </div>
         <DialogFooter>
           <Button variant="outline" onClick={() => onOpenChange(false)} className="text-muted-foreground">
@@ -4,15 +4,23 @@ import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Alert, AlertDescription } from "@/components/ui/alert";
 import { useState } from "react";
-import { Loader2, Webhook, CheckCircle2, Trash2, Info } from "lucide-react";
+import { Loader2, Webhook, CheckCircle2, Trash2, Info, RefreshCw } from "lucide-react";
 import { toast } from "sonner";
 import { useGetResendWebhookSecret } from "@/lib/api/queries";
-import { useSetResendWebhookSecret, useDeleteResendWebhookSecret } from "@/lib/api/mutations";
+import {
+  useSetResendWebhookSecret,
+  useDeleteResendWebhookSecret,
+  useCreateWebhookUrl,
+  useRotateWebhookUrl,
+} from "@/lib/api/mutations";
+import { getWebhookUrl } from "@/lib/utils";
 
 export function WebhookSecretCard() {
   const { data: webhookSecret } = useGetResendWebhookSecret();
   const setWebhookSecret = useSetResendWebhookSecret();
   const deleteWebhookSecret = useDeleteResendWebhookSecret();
+  const createWebhookUrl = useCreateWebhookUrl();
+  const rotateWebhookUrl = useRotateWebhookUrl();
   const [newWebhookSecret, setNewWebhookSecret] = useState("");
 
   const handleSetWebhookSecret = async () => {
@@ -22,10 +30,7 @@ export function WebhookSecretCard() {
     }
 
     try {
-      if (webhookSecret) {
-        await deleteWebhookSecret.mutateAsync(webhookSecret.id);
-      }
-      await setWebhookSecret.mutateAsync(newWebhookSecret);
+      await setWebhookSecret.mutateAsync({ secret: newWebhookSecret, id: webhookSecret?.id });
       setNewWebhookSecret("");
       toast.success("Webhook secret updated successfully");
     } catch (error) {
@@ -33,6 +38,25 @@ export function WebhookSecretCard() {
     }
   };
 
+  const handleCreateWebhookUrl = async () => {
+    try {
+      await createWebhookUrl.mutateAsync();
+    } catch (error) {
+      toast.error("Failed to generate webhook URL");
+    }
+  };
+
+  const handleRotateWebhookUrl = async () => {
+    if (!webhookSecret) return;
+
+    try {
+      await rotateWebhookUrl.mutateAsync(webhookSecret.id);
+      toast.success("Webhook URL rotated, update the endpoint in Resend");
+    } catch (error) {
+      toast.error("Failed to rotate webhook URL");
+    }
+  };
+
   const handleDeleteWebhookSecret = async () => {
     if (!webhookSecret) return;
 
@@ -65,9 +89,31 @@ export function WebhookSecretCard() {
             <div className="space-y-3 text-primary">
               <div>
                 <p className="font-medium mb-1">Webhook endpoint URL:</p>
-                <code className="px-2 py-1 bg-muted rounded text-sm block w-fit">
-                  https://www.resendforward.com/api/webhooks/resend
-                </code>
+                {webhookSecret ? (
+                  <div className="flex items-center gap-2">
+                    <code className="px-2 py-1 bg-muted rounded text-sm block w-fit break-all">
+                      {getWebhookUrl(webhookSecret.webhook_token)}
+                    </code>
+                    <Button
+                      variant="ghost"
+                      size="icon"
+                      className="h-7 w-7"
+                      onClick={handleRotateWebhookUrl}
+                      disabled={rotateWebhookUrl.isPending}
+                    >
+                      {rotateWebhookUrl.isPending ? (
+                        <Loader2 className="h-4 w-4 animate-spin" />
+                      ) : (
+                        <RefreshCw className="h-4 w-4" />
+                      )}
+                      <span className="sr-only">Rotate webhook URL</span>
+                    </Button>
+                  </div>
+                ) : (
+                  <Button size="sm" onClick={handleCreateWebhookUrl} disabled={createWebhookUrl.isPending}>
+                    {createWebhookUrl.isPending ? <Loader2 className="h-4 w-4 animate-spin" /> : "Generate URL"}
+                  </Button>
+                )}
               </div>
               <div>
                 <p className="font-medium mb-1">Enable these events:</p>
@@ -89,7 +135,7 @@ export function WebhookSecretCard() {
             </div>
           </AlertDescription>
         </Alert>
-        {webhookSecret ? (
+        {webhookSecret?.hint ? (
           <div className="space-y-4">
             <div className="flex items-center gap-2 p-4 bg-muted rounded-lg">
               <CheckCircle2 className="h-5 w-5 text-green-600" />
@@ -120,11 +166,8 @@ export function WebhookSecretCard() {
                   onChange={(e) => setNewWebhookSecret(e.target.value)}
                   className="font-mono"
                 />
-                <Button
-                  onClick={handleSetWebhookSecret}
-                  disabled={setWebhookSecret.isPending || deleteWebhookSecret.isPending}
-                >
-                  {setWebhookSecret.isPending || deleteWebhookSecret.isPending ? (
+                <Button onClick={handleSetWebhookSecret} disabled={setWebhookSecret.isPending}>
+                  {setWebhookSecret.isPending ? (
                     <Loader2 className="h-4 w-4 animate-spin" />
                   ) : (
                     "Update"
@@ -134,13 +134,36 @@ export async function getResendWebhookSecret() {
     }
 }
 
-export async function setResendWebhookSecret(webhook_secret: string) {
+export async function setResendWebhookSecret(webhook_secret: string, id?: string) {
+    if (id) {
+        return await pb.collection(Collections.ResendWebhookSecrets).update(id, {
+            secret: webhook_secret
+        });
+    }
     return await pb.collection(Collections.ResendWebhookSecrets).create({
         user: getUserId(),
         secret: webhook_secret
     });
 }
 
+export async function createWebhookUrl() {
+    return await pb.collection(Collections.ResendWebhookSecrets).create({
+        user: getUserId()
+    });
+}
+
+export async function rotateWebhookUrl(id: string) {
+    return await pb.send(`/api/webhook-secrets/${id}/rotate-url`, {
+        method: "POST"
+    });
+}
+
+export async function getAuthenticationStatus(): Promise<{ configured: boolean }> {
+    return await pb.send("/api/authentication/status", {
+        method: "GET"
+    });
+}
+
 export async function deleteResendWebhookSecret(id: string) {
     return await pb.collection(Collections.ResendWebhookSecrets).delete(id);
 }
@@ -1,5 +1,5 @@
 import { useMutation, useQueryClient } from "@tanstack/react-query";
-import { createNewForwardingRule, deleteAccount, deleteForwardingRule, deleteResendAPIkey, deleteResendWebhookSecret, setResendAPIkey, setResendWebhookSecret, updateForwardingRule } from "./api";
+import { createNewForwardingRule, createWebhookUrl, deleteAccount, deleteForwardingRule, deleteResendAPIkey, deleteResendWebhookSecret, rotateWebhookUrl, setResendAPIkey, setResendWebhookSecret, updateForwardingRule } from "./api";
 import { handleError } from "../utils";
 import type { ForwardingRulesRecord } from "../pocketbase-types";
 
@@ -70,7 +70,7 @@ export function useSetResendWebhookSecret() {
     const queryClient = useQueryClient();
 
     return useMutation({
-        mutationFn: (secret: string) => setResendWebhookSecret(secret),
+        mutationFn: ({ secret, id }: { secret: string, id?: string }) => setResendWebhookSecret(secret, id),
         onError: handleError,
         onSuccess: () => {
             queryClient.invalidateQueries({ queryKey: ["resendWebhookSecret"] });
@@ -90,6 +90,30 @@ export function useDeleteResendWebhookSecret() {
     })
 }
 
+export function useCreateWebhookUrl() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: () => createWebhookUrl(),
+        onError: handleError,
+        onSuccess: () => {
+            queryClient.invalidateQueries({ queryKey: ["resendWebhookSecret"] });
+        },
+    })
+}
+
+export function useRotateWebhookUrl() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (id: string) => rotateWebhookUrl(id),
+        onError: handleError,
+        onSuccess: () => {
+            queryClient.invalidateQueries({ queryKey: ["resendWebhookSecret"] });
+        },
+    })
+}
+
 export function useDeleteAccount() {
     return useMutation({
         mutationFn: () => deleteAccount(),
@@ -12,6 +12,7 @@ import {
     getRuleForwardingCount,
     getForwardingStats,
     getRulesStats,
+    getAuthenticationStatus,
 } from "./api";
 import { EventLogsTypeOptions, ForwardingEventsStatusOptions } from "../pocketbase-types";
 
@@ -105,4 +106,11 @@ export function useGetRulesStats() {
         queryFn: getRulesStats,
         placeholderData: keepPreviousData
     });
-}
\ No newline at end of file
+}
+
+export function useGetAuthenticationStatus() {
+    return useQuery({
+        queryKey: ['authenticationStatus'],
+        queryFn: getAuthenticationStatus,
+    });
+}
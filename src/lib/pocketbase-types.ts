@@ -11,15 +11,25 @@ export enum Collections {
 	Mfas = "_mfas",
 	Otps = "_otps",
 	Superusers = "_superusers",
+	DeliveryProviders = "delivery_providers",
 	EventLogs = "event_logs",
 	ForwardingCounts = "forwarding_counts",
+	ForwardingDeliveries = "forwarding_deliveries",
 	ForwardingEvents = "forwarding_events",
+	ForwardingJobs = "forwarding_jobs",
 	ForwardingRules = "forwarding_rules",
 	ForwardingStats = "forwarding_stats",
+	Quarantine = "quarantine",
 	ResendApiKeys = "resend_api_keys",
 	ResendWebhookSecrets = "resend_webhook_secrets",
+	ReverseAliases = "reverse_aliases",
+	RuleDestinations = "rule_destinations",
 	RulesStats = "rules_stats",
+	SecurityAuditLogs = "security_audit_logs",
+	SenderFilters = "sender_filters",
+	Suppressions = "suppressions",
 	Users = "users",
+	WebhookReceipts = "webhook_receipts",
 }
 
 // Alias types for improved usability
@@ -100,6 +110,24 @@ export type SuperusersRecord = {
 	verified?: boolean
 }
 
+export enum DeliveryProvidersTypeOptions {
+	"resend" = "resend",
+	"smtp" = "smtp",
+}
+export type DeliveryProvidersRecord = {
+	created: IsoAutoDateString
+	host?: string
+	id: string
+	is_default?: boolean
+	name?: string
+	port?: number
+	secret?: string
+	type: DeliveryProvidersTypeOptions
+	updated: IsoAutoDateString
+	user: RecordIdString
+	username?: string
+}
+
 export enum EventLogsTypeOptions {
 	"webhook.received" = "webhook.received",
 	"forward.initiated" = "forward.initiated",
@@ -107,6 +135,26 @@ export enum EventLogsTypeOptions {
 	"email.delivered" = "email.delivered",
 	"email.failed" = "email.failed",
 	"error" = "error",
+	"forward.retrying" = "forward.retrying",
+	"forward.replayed" = "forward.replayed",
+	"rule.evaluated" = "rule.evaluated",
+	"rule.disabled" = "rule.disabled",
+	"forward.released" = "forward.released",
+	"bounce.sent" = "bounce.sent",
+	"webhook.response" = "webhook.response",
+	"email.bounced" = "email.bounced",
+	"email.complained" = "email.complained",
+	"email.delivery_delayed" = "email.delivery_delayed",
+	"email.opened" = "email.opened",
+	"email.clicked" = "email.clicked",
+	"recipient.suppressed" = "recipient.suppressed",
+	"recipient.unsuppressed" = "recipient.unsuppressed",
+	"sender.blocked" = "sender.blocked",
+	"auth.failed" = "auth.failed",
+	"message.quarantined" = "message.quarantined",
+	"quarantine.deleted" = "quarantine.deleted",
+	"reply.sent" = "reply.sent",
+	"reply.rejected" = "reply.rejected",
 }
 export type EventLogsRecord<Tmetadata = unknown> = {
 	created: IsoAutoDateString
@@ -126,37 +174,135 @@ export type ForwardingCountsRecord = {
 	user: RecordIdString
 }
 
+export enum ForwardingDeliveriesStatusOptions {
+	"pending" = "pending",
+	"sent" = "sent",
+	"delivered" = "delivered",
+	"failed" = "failed",
+	"bounced" = "bounced",
+	"complained" = "complained",
+	"delayed" = "delayed",
+}
+
+export enum ForwardingDeliveriesTypeOptions {
+	"email" = "email",
+	"webhook" = "webhook",
+	"slack" = "slack",
+	"discord" = "discord",
+}
+export type ForwardingDeliveriesRecord<Terror = unknown> = {
+	created: IsoAutoDateString
+	destination?: RecordIdString
+	error?: null | Terror
+	event: RecordIdString
+	id: string
+	recipient: string
+	rule: RecordIdString
+	sent_email_id?: string
+	status: ForwardingDeliveriesStatusOptions
+	type?: ForwardingDeliveriesTypeOptions
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
 export enum ForwardingEventsStatusOptions {
 	"pending" = "pending",
 	"delivered" = "delivered",
 	"failed" = "failed",
 	"sent" = "sent",
+	"retrying" = "retrying",
+	"partial" = "partial",
+	"dropped" = "dropped",
+	"held" = "held",
+	"bounced" = "bounced",
+	"complained" = "complained",
+	"delayed" = "delayed",
+	"blocked" = "blocked",
+	"quarantined" = "quarantined",
+	"returned" = "returned",
+}
+
+export enum ForwardingEventsSourceOptions {
+	"resend" = "resend",
+	"smtp" = "smtp",
 }
-export type ForwardingEventsRecord<Terror = unknown> = {
+export type ForwardingEventsRecord<Tauthentication = unknown, Terror = unknown, Tmetadata = unknown> = {
+	attempts?: number
+	authentication?: null | Tauthentication
 	created: IsoAutoDateString
 	error?: null | Terror
 	from?: string
 	id: string
+	metadata?: null | Tmetadata
+	next_attempt_at?: IsoDateString
+	raw_message?: string
 	received_email_id: string
+	replay_of?: RecordIdString
 	rule: RecordIdString
 	sent_email_id?: string
+	source?: ForwardingEventsSourceOptions
 	status: ForwardingEventsStatusOptions
 	subject?: string
 	to?: string
 	updated: IsoAutoDateString
 	user: RecordIdString
+	webhook_secret?: RecordIdString
+}
+
+export enum ForwardingJobsTypeOptions {
+	"forward" = "forward",
+	"bounce" = "bounce",
+	"archive" = "archive",
 }
 
-export type ForwardingRulesRecord = {
+export enum ForwardingJobsStatusOptions {
+	"queued" = "queued",
+	"processing" = "processing",
+	"completed" = "completed",
+	"failed" = "failed",
+}
+export type ForwardingJobsRecord = {
+	attempts?: number
 	created: IsoAutoDateString
+	event: RecordIdString
+	id: string
+	last_error?: string
+	locked_at?: IsoDateString
+	run_after?: IsoDateString
+	status: ForwardingJobsStatusOptions
+	type: ForwardingJobsTypeOptions
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
+export enum ForwardingRulesAuthPolicyOptions {
+	"forward" = "forward",
+	"tag" = "tag",
+	"quarantine" = "quarantine",
+}
+
+export enum ForwardingRulesDisabledActionOptions {
+	"drop" = "drop",
+	"hold" = "hold",
+	"bounce" = "bounce",
+}
+export type ForwardingRulesRecord<Tconditions = unknown> = {
+	auth_policy?: ForwardingRulesAuthPolicyOptions
+	catch_all?: boolean
+	conditions?: null | Tconditions
+	created: IsoAutoDateString
+	disabled_action?: ForwardingRulesDisabledActionOptions
 	enabled?: boolean
 	forward_to_email: string
 	id: string
+	provider?: RecordIdString
+	reply_through?: boolean
 	rule_email: string
 	rule_name?: string
 	send_from_email: string
 	updated: IsoAutoDateString
 	user: RecordIdString
+	webhook_secret?: string
 }
 
 export type ForwardingStatsRecord = {
@@ -167,20 +313,84 @@ export type ForwardingStatsRecord = {
 	user: RecordIdString
 }
 
+export enum QuarantineReasonOptions {
+	"auth_failed" = "auth_failed",
+	"sender_blocked" = "sender_blocked",
+}
+export type QuarantineRecord<Tdetails = unknown> = {
+	created: IsoAutoDateString
+	details?: null | Tdetails
+	expires_at?: IsoDateString
+	forwarding_event: RecordIdString
+	id: string
+	reason: QuarantineReasonOptions
+	rule?: RecordIdString
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
+export enum ResendApiKeysPermissionOptions {
+	"full_access" = "full_access",
+	"sending_access" = "sending_access",
+}
 export type ResendApiKeysRecord = {
 	created: IsoAutoDateString
+	hint?: string
 	id: string
 	key: string
+	name?: string
+	permission?: ResendApiKeysPermissionOptions
+	rotated_at?: IsoDateString
 	updated: IsoAutoDateString
 	user: RecordIdString
 }
 
 export type ResendWebhookSecretsRecord = {
+	api_key?: RecordIdString
 	created: IsoAutoDateString
+	hint?: string
 	id: string
-	secret: string
+	name?: string
+	rotated_at?: IsoDateString
+	secret?: string
 	updated: IsoAutoDateString
 	user: RecordIdString
+	webhook_token?: string
+}
+
+export type ReverseAliasesRecord = {
+	alias: string
+	created: IsoAutoDateString
+	id: string
+	rule: RecordIdString
+	sender: string
+	sender_name?: string
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
+export enum RuleDestinationsAttachmentModeOptions {
+	"base64" = "base64",
+	"link" = "link",
+}
+
+export enum RuleDestinationsTypeOptions {
+	"email" = "email",
+	"webhook" = "webhook",
+	"slack" = "slack",
+	"discord" = "discord",
+}
+export type RuleDestinationsRecord = {
+	attachment_mode?: RuleDestinationsAttachmentModeOptions
+	created: IsoAutoDateString
+	email?: string
+	enabled?: boolean
+	id: string
+	rule: RecordIdString
+	type: RuleDestinationsTypeOptions
+	updated: IsoAutoDateString
+	url?: string
+	user: RecordIdString
 }
 
 export type RulesStatsRecord = {
@@ -190,6 +400,62 @@ export type RulesStatsRecord = {
 	user: RecordIdString
 }
 
+export enum SecurityAuditLogsTypeOptions {
+	"webhook.rejected" = "webhook.rejected",
+}
+
+export enum SecurityAuditLogsReasonOptions {
+	"unknown_token" = "unknown_token",
+	"webhook_secret_not_found" = "webhook_secret_not_found",
+	"webhook_secret_invalid" = "webhook_secret_invalid",
+	"invalid_signature" = "invalid_signature",
+}
+export type SecurityAuditLogsRecord<Tmetadata = unknown> = {
+	created: IsoAutoDateString
+	id: string
+	ip?: string
+	metadata?: null | Tmetadata
+	path?: string
+	reason: SecurityAuditLogsReasonOptions
+	svix_id?: string
+	type: SecurityAuditLogsTypeOptions
+	updated: IsoAutoDateString
+	user?: RecordIdString
+	user_agent?: string
+}
+
+export enum SenderFiltersActionOptions {
+	"allow" = "allow",
+	"block" = "block",
+}
+export type SenderFiltersRecord = {
+	action: SenderFiltersActionOptions
+	created: IsoAutoDateString
+	id: string
+	note?: string
+	pattern: string
+	rule?: RecordIdString
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
+export enum SuppressionsReasonOptions {
+	"hard_bounce" = "hard_bounce",
+	"complaint" = "complaint",
+}
+export type SuppressionsRecord<Tdisabled_destinations = unknown, Tpaused_rules = unknown> = {
+	created: IsoAutoDateString
+	disabled_destinations?: null | Tdisabled_destinations
+	email: string
+	forwarding_event?: RecordIdString
+	id: string
+	paused_rules?: null | Tpaused_rules
+	reason: SuppressionsReasonOptions
+	rule?: RecordIdString
+	updated: IsoAutoDateString
+	user: RecordIdString
+}
+
 export type UsersRecord = {
 	avatar?: FileNameString
 	created: IsoAutoDateString
@@ -203,21 +469,42 @@ export type UsersRecord = {
 	verified?: boolean
 }
 
+export type WebhookReceiptsRecord<Tresponse = unknown> = {
+	created: IsoAutoDateString
+	email_id?: string
+	id: string
+	response?: null | Tresponse
+	status_code?: number
+	svix_id: string
+	type: string
+	updated: IsoAutoDateString
+}
+
 // Response types include system fields and match responses from the PocketBase API
 export type AuthoriginsResponse<Texpand = unknown> = Required<AuthoriginsRecord> & BaseSystemFields<Texpand>
 export type ExternalauthsResponse<Texpand = unknown> = Required<ExternalauthsRecord> & BaseSystemFields<Texpand>
 export type MfasResponse<Texpand = unknown> = Required<MfasRecord> & BaseSystemFields<Texpand>
 export type OtpsResponse<Texpand = unknown> = Required<OtpsRecord> & BaseSystemFields<Texpand>
 export type SuperusersResponse<Texpand = unknown> = Required<SuperusersRecord> & AuthSystemFields<Texpand>
+export type DeliveryProvidersResponse<Texpand = unknown> = Required<DeliveryProvidersRecord> & BaseSystemFields<Texpand>
 export type EventLogsResponse<Tmetadata = unknown, Texpand = unknown> = Required<EventLogsRecord<Tmetadata>> & BaseSystemFields<Texpand>
 export type ForwardingCountsResponse<Texpand = unknown> = Required<ForwardingCountsRecord> & BaseSystemFields<Texpand>
-export type ForwardingEventsResponse<Terror = unknown, Texpand = unknown> = Required<ForwardingEventsRecord<Terror>> & BaseSystemFields<Texpand>
-export type ForwardingRulesResponse<Texpand = unknown> = Required<ForwardingRulesRecord> & BaseSystemFields<Texpand>
+export type ForwardingDeliveriesResponse<Terror = unknown, Texpand = unknown> = Required<ForwardingDeliveriesRecord<Terror>> & BaseSystemFields<Texpand>
+export type ForwardingEventsResponse<Tauthentication = unknown, Terror = unknown, Tmetadata = unknown, Texpand = unknown> = Required<ForwardingEventsRecord<Tauthentication, Terror, Tmetadata>> & BaseSystemFields<Texpand>
+export type ForwardingJobsResponse<Texpand = unknown> = Required<ForwardingJobsRecord> & BaseSystemFields<Texpand>
+export type ForwardingRulesResponse<Tconditions = unknown, Texpand = unknown> = Required<ForwardingRulesRecord<Tconditions>> & BaseSystemFields<Texpand>
 export type ForwardingStatsResponse<Texpand = unknown> = Required<ForwardingStatsRecord> & BaseSystemFields<Texpand>
+export type QuarantineResponse<Tdetails = unknown, Texpand = unknown> = Required<QuarantineRecord<Tdetails>> & BaseSystemFields<Texpand>
 export type ResendApiKeysResponse<Texpand = unknown> = Required<ResendApiKeysRecord> & BaseSystemFields<Texpand>
 export type ResendWebhookSecretsResponse<Texpand = unknown> = Required<ResendWebhookSecretsRecord> & BaseSystemFields<Texpand>
+export type ReverseAliasesResponse<Texpand = unknown> = Required<ReverseAliasesRecord> & BaseSystemFields<Texpand>
+export type RuleDestinationsResponse<Texpand = unknown> = Required<RuleDestinationsRecord> & BaseSystemFields<Texpand>
 export type RulesStatsResponse<Texpand = unknown> = Required<RulesStatsRecord> & BaseSystemFields<Texpand>
+export type SecurityAuditLogsResponse<Tmetadata = unknown, Texpand = unknown> = Required<SecurityAuditLogsRecord<Tmetadata>> & BaseSystemFields<Texpand>
+export type SenderFiltersResponse<Texpand = unknown> = Required<SenderFiltersRecord> & BaseSystemFields<Texpand>
+export type SuppressionsResponse<Tdisabled_destinations = unknown, Tpaused_rules = unknown, Texpand = unknown> = Required<SuppressionsRecord<Tdisabled_destinations, Tpaused_rules>> & BaseSystemFields<Texpand>
 export type UsersResponse<Texpand = unknown> = Required<UsersRecord> & AuthSystemFields<Texpand>
+export type WebhookReceiptsResponse<Tresponse = unknown, Texpand = unknown> = Required<WebhookReceiptsRecord<Tresponse>> & BaseSystemFields<Texpand>
 
 // Types containing all Records and Responses, useful for creating typing helper functions
 
@@ -227,15 +514,25 @@ export type CollectionRecords = {
 	_mfas: MfasRecord
 	_otps: OtpsRecord
 	_superusers: SuperusersRecord
+	delivery_providers: DeliveryProvidersRecord
 	event_logs: EventLogsRecord
 	forwarding_counts: ForwardingCountsRecord
+	forwarding_deliveries: ForwardingDeliveriesRecord
 	forwarding_events: ForwardingEventsRecord
+	forwarding_jobs: ForwardingJobsRecord
 	forwarding_rules: ForwardingRulesRecord
 	forwarding_stats: ForwardingStatsRecord
+	quarantine: QuarantineRecord
 	resend_api_keys: ResendApiKeysRecord
 	resend_webhook_secrets: ResendWebhookSecretsRecord
+	reverse_aliases: ReverseAliasesRecord
+	rule_destinations: RuleDestinationsRecord
 	rules_stats: RulesStatsRecord
+	security_audit_logs: SecurityAuditLogsRecord
+	sender_filters: SenderFiltersRecord
+	suppressions: SuppressionsRecord
 	users: UsersRecord
+	webhook_receipts: WebhookReceiptsRecord
 }
 
 export type CollectionResponses = {
@@ -244,15 +541,25 @@ export type CollectionResponses = {
 	_mfas: MfasResponse
 	_otps: OtpsResponse
 	_superusers: SuperusersResponse
+	delivery_providers: DeliveryProvidersResponse
 	event_logs: EventLogsResponse
 	forwarding_counts: ForwardingCountsResponse
+	forwarding_deliveries: ForwardingDeliveriesResponse
 	forwarding_events: ForwardingEventsResponse
+	forwarding_jobs: ForwardingJobsResponse
 	forwarding_rules: ForwardingRulesResponse
 	forwarding_stats: ForwardingStatsResponse
+	quarantine: QuarantineResponse
 	resend_api_keys: ResendApiKeysResponse
 	resend_webhook_secrets: ResendWebhookSecretsResponse
+	reverse_aliases: ReverseAliasesResponse
+	rule_destinations: RuleDestinationsResponse
 	rules_stats: RulesStatsResponse
+	security_audit_logs: SecurityAuditLogsResponse
+	sender_filters: SenderFiltersResponse
+	suppressions: SuppressionsResponse
 	users: UsersResponse
+	webhook_receipts: WebhookReceiptsResponse
 }
 
 // Utility types for create/update operations
@@ -39,6 +39,10 @@ export function getUserName(): string {
   return user?.name;
 }
 
+export function getWebhookUrl(token: string): string {
+  return `https://www.resendforward.com/api/webhooks/resend/${token}`;
+}
+
 export const getDateRange = (range: string) => {
   const now = new Date();
   switch (range) {